@@ -6,59 +6,231 @@ package cfg
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// CachePrefix is the prefix of keys holding state that generators keep
+// between runs. Such keys are not persisted.
+const CachePrefix = "cache."
+
 // Config is a map containing configuration key-value pairs.
+// Config is safe for concurrent use.
 type Config struct {
-	m map[string]string
+	m   map[string]string
+	mux *sync.RWMutex
+	// Values of the keys that are not set, used by the getters
+	defaults map[string]string
 }
 
 // NewConfig allocates a configuration map.
 func NewConfig() *Config {
-	return &Config{make(map[string]string)}
+	return FromMap(make(map[string]string))
 }
 
 // FromMap converts a string map into a Config object.
 func FromMap(m map[string]string) *Config {
-	return &Config{m}
+	return &Config{m: m, mux: &sync.RWMutex{}}
+}
+
+// WithDefaults returns a view of the same configuration where the getters other than
+// Get return the values in defaults for keys that are not set. Keys put in either are
+// visible in both. Defaults are not returned by Map, Persistent and Prefixed.
+func (cf *Config) WithDefaults(defaults map[string]string) *Config {
+	return &Config{m: cf.m, mux: cf.mux, defaults: defaults}
 }
 
-// Map returns the underlying map of a Config object.
+// Map returns a copy of the map of a Config object.
 func (cf *Config) Map() map[string]string {
-	return cf.m
+	cf.mux.RLock()
+	defer cf.mux.RUnlock()
+	m := make(map[string]string, len(cf.m))
+	for k, v := range cf.m {
+		m[k] = v
+	}
+	return m
+}
+
+// Persistent returns a copy of the map of a Config object without cache keys.
+func (cf *Config) Persistent() map[string]string {
+	m := cf.Map()
+	for k := range m {
+		if strings.HasPrefix(k, CachePrefix) {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+// Prefixed returns all key value pairs where the key starts with prefix.
+// The prefix is removed from the returned keys.
+func (cf *Config) Prefixed(prefix string) map[string]string {
+	cf.mux.RLock()
+	defer cf.mux.RUnlock()
+	m := make(map[string]string)
+	for k, v := range cf.m {
+		if strings.HasPrefix(k, prefix) {
+			m[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return m
 }
 
 // Put adds a key value pair, overriding any previous entry.
 func (cf *Config) Put(k, v string) {
+	cf.mux.Lock()
 	cf.m[k] = v
+	cf.mux.Unlock()
 }
 
 // Get returns the value for a key k or false if not present.
 func (cf *Config) Get(k string) (string, bool) {
+	cf.mux.RLock()
+	defer cf.mux.RUnlock()
 	v, ok := cf.m[k]
 	return v, ok
 }
 
-// GetVal returns the value for a key k or defaultVal if not present.
+// GetVal returns the value for a key k or, if not present, its default or defaultVal.
 func (cf *Config) GetVal(k, defaultVal string) string {
-	if v, ok := cf.m[k]; ok {
+	if v, ok := cf.Get(k); ok {
+		return v
+	}
+	if v, ok := cf.defaults[k]; ok {
 		return v
 	}
 	return defaultVal
 }
 
+// getSet returns the value for a key k or its default if k is not set or empty.
+func (cf *Config) getSet(k string) (string, bool) {
+	if v, ok := cf.Get(k); ok && v != "" {
+		return v, true
+	}
+	v, ok := cf.defaults[k]
+	return v, ok
+}
+
+// GetInt returns the integer value for a key k or, if not present, its default or defaultVal.
+func (cf *Config) GetInt(k string, defaultVal int) (int, error) {
+	v, ok := cf.getSet(k)
+	if !ok {
+		return defaultVal, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid integer '%s'", k, v)
+	}
+	return n, nil
+}
+
+// GetBool returns the boolean value for a key k or, if not present, its default or defaultVal.
+func (cf *Config) GetBool(k string, defaultVal bool) (bool, error) {
+	v, ok := cf.getSet(k)
+	if !ok {
+		return defaultVal, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean '%s'", k, v)
+	}
+	return b, nil
+}
+
+// GetDuration returns the duration value for a key k or, if not present, its default or defaultVal.
+func (cf *Config) GetDuration(k string, defaultVal time.Duration) (time.Duration, error) {
+	v, ok := cf.getSet(k)
+	if !ok {
+		return defaultVal, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid duration '%s'", k, v)
+	}
+	return d, nil
+}
+
+// PutList adds a list of values for key k as the keys k.0, k.1, etc.
+func (cf *Config) PutList(k string, vs []string) {
+	cf.mux.Lock()
+	for i, v := range vs {
+		cf.m[fmt.Sprintf("%s.%d", k, i)] = v
+	}
+	cf.mux.Unlock()
+}
+
+// GetList returns the list of values for key k stored with PutList. If there
+// is no list, the value of k is returned as the only element, if present.
+func (cf *Config) GetList(k string) []string {
+	cf.mux.RLock()
+	defer cf.mux.RUnlock()
+	var vs []string
+	for i := 0; ; i++ {
+		v, ok := cf.m[fmt.Sprintf("%s.%d", k, i)]
+		if !ok {
+			break
+		}
+		vs = append(vs, v)
+	}
+	if vs == nil {
+		if v, ok := cf.m[k]; ok {
+			vs = []string{v}
+		}
+	}
+	return vs
+}
+
 // FromJSON unmarshals JSON data read from r into a Config object.
+// Arrays of strings, numbers and booleans are stored like repeated form fields:
+// the last value under the key and all values as a list. Other values that are
+// not strings are kept as JSON text.
 func (cf *Config) FromJSON(r io.Reader) error {
-	m := make(map[string]string)
+	m := make(map[string]json.RawMessage)
 	if err := json.NewDecoder(r).Decode(&m); err != nil {
 		return err
 	}
-	for k, v := range m {
-		if strings.HasPrefix(k, "config.") || strings.HasPrefix(k, "source.") {
-			cf.m[k] = v
+	for k, raw := range m {
+		if !strings.HasPrefix(k, "config.") && !strings.HasPrefix(k, "source.") {
+			continue
+		}
+		var v string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			cf.Put(k, v)
+			continue
+		}
+		vs, ok := jsonList(raw)
+		if !ok {
+			cf.Put(k, string(raw))
+			continue
+		}
+		cf.Put(k, vs[len(vs)-1])
+		if len(vs) > 1 {
+			cf.PutList(k, vs)
 		}
 	}
 	return nil
 }
+
+// jsonList returns the values of raw if it is a non-empty array of strings,
+// numbers and booleans. Numbers and booleans are returned as JSON text.
+func jsonList(raw json.RawMessage) ([]string, bool) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil || len(elems) == 0 {
+		return nil, false
+	}
+	vs := make([]string, len(elems))
+	for i, e := range elems {
+		if err := json.Unmarshal(e, &vs[i]); err == nil {
+			continue
+		}
+		if e[0] == '[' || e[0] == '{' || e[0] == 'n' {
+			return nil, false
+		}
+		vs[i] = string(e)
+	}
+	return vs, true
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cfg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromJSON(t *testing.T) {
+	cf := NewConfig()
+	err := cf.FromJSON(strings.NewReader(`{
+		"source.name": "lab",
+		"config.port": 3306,
+		"config.path": ["a.lan"],
+		"config.pattern": ["a[1-2] -> 10.0.0.{n}", "b -> 10.0.1.1"],
+		"config.column": [1, true],
+		"config.entries": [["a.lan", "10.0.0.1"]],
+		"config.empty": [],
+		"other": "skipped"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"source.name":      "lab",
+		"config.port":      "3306",
+		"config.path":      "a.lan",
+		"config.pattern":   "b -> 10.0.1.1",
+		"config.pattern.0": "a[1-2] -> 10.0.0.{n}",
+		"config.pattern.1": "b -> 10.0.1.1",
+		"config.column":    "true",
+		"config.column.0":  "1",
+		"config.column.1":  "true",
+		"config.entries":   `[["a.lan", "10.0.0.1"]]`,
+		"config.empty":     "[]",
+	}
+	if m := cf.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	if vs := cf.GetList("config.pattern"); len(vs) != 2 {
+		t.Errorf("expected two patterns, got %v", vs)
+	}
+}
@@ -5,14 +5,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	// Drivers for the sql source type
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
 	"github.com/dullgiulio/kuradns"
+	"github.com/dullgiulio/kuradns/gen"
 )
 
 func main() {
@@ -24,6 +32,7 @@ func main() {
 		save       = flag.String("save", "", "Save or restore sources from/to file `F`")
 		info       = flag.Bool("info", false, "Show log messages on client requests")
 		ttl        = flag.Duration("ttl", 1*time.Hour, "Duration `D` to be cached for DNS responses")
+		allowExec  = flag.Bool("allow-exec", false, "Allow sources of type exec, running commands as the user of this server")
 	)
 	flag.Usage = func() {
 		// TODO: Write extensive usage of HTTP API
@@ -32,9 +41,33 @@ func main() {
 	}
 	flag.Parse()
 
+	if *allowExec {
+		gen.RegisterExec()
+	}
 	srv := kuradns.NewServer(*save, *zone, *hostname, *info, *ttl)
 
 	go srv.ServeDNS(*dnsListen)
+
+	hsrv := &http.Server{Addr: *httpListen, Handler: srv}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-sigs
+		log.Printf("[info] received %s, shutting down", sig)
+		// Abort updates of sources first, so that pending HTTP requests can complete
+		srv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := hsrv.Shutdown(ctx); err != nil {
+			log.Printf("[error] http: shutdown: %s", err)
+		}
+	}()
+
 	log.Printf("[info] http: listening on %s", *httpListen)
-	log.Fatal(http.ListenAndServe(*httpListen, srv))
+	if err := hsrv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
 }
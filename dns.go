@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/miekg/dns"
+
+	"github.com/dullgiulio/kuradns/gen"
 )
 
 // Represent a SOA record shared system-wide.
@@ -71,16 +73,16 @@ func (s *server) newDnsRR(name host) dns.RR {
 }
 
 // handleDnsA modifies m to reply to a A/ANY query by looking up name from the
-// repository. NXDOMAIN and the SOA record are returned for nonexisting entries.
+// repository, following its CNAME records. NXDOMAIN and the SOA record are returned
+// for nonexisting entries.
 func (s *server) handleDnsA(name host, m *dns.Msg) {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 
 	// Important: all things set here must be overwritten
-	rec := s.repo.get(name)
-	if rec != nil && rec.a != nil {
-		m.Answer = make([]dns.RR, 1)
-		m.Answer[0] = rec.a
+	rrs := s.repo.getChain(name, dns.TypeA)
+	if rrs != nil {
+		m.Answer = rrs
 		m.Ns = nil
 		m.MsgHdr.Rcode = dns.RcodeSuccess
 	} else {
@@ -91,16 +93,16 @@ func (s *server) handleDnsA(name host, m *dns.Msg) {
 }
 
 // handleDnsAAAA modifies m to reply to a AAAA query by looking up name from the
-// repository. NXDOMAIN and the SOA record are returned for nonexisting entries.
+// repository, following its CNAME records. NXDOMAIN and the SOA record are returned
+// for nonexisting entries.
 func (s *server) handleDnsAAAA(name host, m *dns.Msg) {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 
 	// Important: all things set here must be overwritten
-	rec := s.repo.get(name)
-	if rec != nil && rec.aaaa != nil {
-		m.Answer = make([]dns.RR, 1)
-		m.Answer[0] = rec.aaaa
+	rrs := s.repo.getChain(name, dns.TypeAAAA)
+	if rrs != nil {
+		m.Answer = rrs
 		m.Ns = nil
 		m.MsgHdr.Rcode = dns.RcodeSuccess
 	} else {
@@ -116,9 +118,9 @@ func (s *server) handleDnsCNAME(name host, m *dns.Msg) {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 
-	rec := s.repo.get(name)
-	if rec != nil && rec.cname != nil {
-		m.Answer = append(m.Answer, rec.cname)
+	rr := s.repo.get(name, dns.TypeCNAME)
+	if rr != nil {
+		m.Answer = append(m.Answer, rr)
 		m.Ns = nil
 		m.MsgHdr.Rcode = dns.RcodeSuccess
 	} else {
@@ -136,8 +138,38 @@ func (s *server) handleDnsNS(name host) *dns.Msg {
 	return m
 }
 
-// handleDnsMX writes a MX record pointing to s.host into m for host name.
+// handleDnsRecords modifies m to respond to a query of type qtype for name with all
+// records of that type in the repository. If there are no such records, the SOA record
+// is returned with NXDOMAIN, or with no error if name has records of other types.
+func (s *server) handleDnsRecords(name host, qtype uint16, m *dns.Msg) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	rrs := s.repo.getAll(name, qtype)
+	if rrs != nil {
+		m.Answer = rrs
+		m.Ns = nil
+		m.MsgHdr.Rcode = dns.RcodeSuccess
+		return
+	}
+	m.Answer = nil
+	m.MsgHdr.Rcode = dns.RcodeNameError
+	if s.repo.find(name) != nil {
+		m.MsgHdr.Rcode = dns.RcodeSuccess
+	}
+	s.soa.write(m)
+}
+
+// handleDnsMX writes the MX records for host name into m. If the repository has
+// none, a MX record pointing to s.host is written.
 func (s *server) handleDnsMX(name host, m *dns.Msg) {
+	s.mux.RLock()
+	rrs := s.repo.getAll(name, dns.TypeMX)
+	s.mux.RUnlock()
+	if rrs != nil {
+		m.Answer = rrs
+		return
+	}
 	r := new(dns.MX)
 	r.Hdr = dns.RR_Header{
 		Name:   name.dns(),
@@ -165,8 +197,8 @@ func (s *server) writeDnsMsg(w dns.ResponseWriter, m *dns.Msg) {
 
 // handleQuery handles a single DNS query r writing a DNS response message to w.
 //
-// Currently CNAME, ANY/A/AAAA and NS are supported queries. Other queries will be logged but
-// not responded to.
+// Currently CNAME, ANY/A/AAAA, NS, MX and the record types that sources can generate are supported
+// queries. Other queries will be logged but not responded to.
 func (s *server) handleQuery(w dns.ResponseWriter, r *dns.Msg) {
 	switch r.Question[0].Qtype {
 	case dns.TypeANY, dns.TypeA, dns.TypeAAAA:
@@ -215,7 +247,19 @@ func (s *server) handleQuery(w dns.ResponseWriter, r *dns.Msg) {
 		m.SetReply(r)
 		s.writeDnsMsg(w, m)
 	default:
-		s.logDns(w, "error", "unhandled request: %s", r.Question[0].Qtype)
+		qtype := dns.TypeToString[r.Question[0].Qtype]
+		if _, err := gen.ParseType(qtype); qtype == "" || err != nil {
+			s.logDns(w, "error", "unhandled request: %s", qtype)
+			return
+		}
+		if s.verbose {
+			s.logDns(w, "info", "request for %s %s", qtype, r.Question[0].Name)
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		s.handleDnsRecords(host(r.Question[0].Name), r.Question[0].Qtype, m)
+		s.writeDnsMsg(w, m)
 	}
 }
 
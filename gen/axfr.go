@@ -0,0 +1,109 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("axfr", newAxfr, Meta{
+		Description: "Records transferred with AXFR from a primary server",
+		Keys: []Key{
+			{Name: "config.primary", Required: true},
+			{Name: "config.zone"},
+			{Name: "config.timeout", Type: TypeDuration, Default: "10s"},
+			{Name: "config.tsig.name"},
+			{Name: "config.tsig.secret", Secret: true},
+			{Name: "config.tsig.algorithm", Default: "hmac-sha256", Values: []string{"hmac-md5", "hmac-sha1", "hmac-sha256", "hmac-sha512"}},
+		},
+	})
+}
+
+// tsigAlgorithms maps the names accepted in config.tsig.algorithm to TSIG algorithms.
+var tsigAlgorithms = map[string]string{
+	"hmac-md5":    dns.HmacMD5,
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// newAxfr returns a generator yielding the records transferred with AXFR from
+// the primary server config.primary. The zone transferred is config.zone,
+// by default the zone served. If config.tsig.name is set, the transfer is signed
+// with the base64 secret config.tsig.secret using config.tsig.algorithm.
+func newAxfr(ctx context.Context, c *cfg.Config) (Generator, error) {
+	primary, ok := c.Get("config.primary")
+	if !ok || primary == "" {
+		return nil, errors.New("axfr primary server not specified")
+	}
+	if _, _, err := net.SplitHostPort(primary); err != nil {
+		primary = net.JoinHostPort(primary, "53")
+	}
+	zone := dns.Fqdn(c.GetVal("config.zone", c.GetVal("dns.zone", "lan")))
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	t := &dns.Transfer{
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+	if name, ok := c.Get("config.tsig.name"); ok && name != "" {
+		secret, ok := c.Get("config.tsig.secret")
+		if !ok || secret == "" {
+			return nil, errors.New("axfr tsig secret not specified")
+		}
+		alg, ok := tsigAlgorithms[strings.ToLower(c.GetVal("config.tsig.algorithm", ""))]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tsig algorithm '%s'", c.GetVal("config.tsig.algorithm", ""))
+		}
+		name = dns.Fqdn(name)
+		t.TsigSecret = map[string]string{name: secret}
+		m.SetTsig(name, alg, 300, time.Now().Unix())
+	}
+	conn, err := dialContext(ctx, "tcp", primary, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot transfer %s from %s: %s", zone, primary, err)
+	}
+	defer closeOnDone(ctx, conn)()
+	t.Conn = &dns.Conn{Conn: conn}
+	env, err := t.In(m, primary)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot transfer %s from %s: %s", zone, primary, err)
+	}
+	entries := make([]*RawEntry, 0)
+	// The channel must be drained for the transfer to terminate.
+	for e := range env {
+		if e.Error != nil {
+			if err == nil {
+				err = fmt.Errorf("cannot transfer %s from %s: %s", zone, primary, e.Error)
+			}
+			continue
+		}
+		for _, rr := range e.RR {
+			if re := rrEntry(rr); re != nil {
+				entries = append(entries, re)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newListgen(entries), nil
+}
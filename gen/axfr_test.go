@@ -0,0 +1,87 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestAxfr(t *testing.T) {
+	const secret = "c2VjcmV0a2V5"
+	mustRR := func(s string) dns.RR {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+	soa := mustRR("example.lan. 3600 IN SOA ns1.example.lan. hostmaster.example.lan. 1 3600 600 86400 300")
+	rrs := []dns.RR{
+		soa,
+		mustRR("example.lan. 3600 IN NS ns1.example.lan."),
+		mustRR("ns1.example.lan. 3600 IN A 10.0.0.53"),
+		mustRR("www.example.lan. 300 IN CNAME ns1.example.lan."),
+		soa,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := dns.NewServeMux()
+	mux.HandleFunc("example.lan.", func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+		ch := make(chan *dns.Envelope)
+		tr := new(dns.Transfer)
+		go tr.Out(w, r, ch)
+		ch <- &dns.Envelope{RR: rrs}
+		close(ch)
+		w.Hijack()
+	})
+	srv := &dns.Server{
+		Listener:   l,
+		Handler:    mux,
+		TsigSecret: map[string]string{"xfr.key.": secret},
+	}
+	go srv.ActivateAndServe()
+	defer srv.Shutdown()
+
+	conf := cfg.FromMap(map[string]string{
+		"dns.zone":              "example.lan",
+		"config.primary":        l.Addr().String(),
+		"config.tsig.name":      "xfr.key",
+		"config.tsig.secret":    secret,
+		"config.tsig.algorithm": "hmac-md5",
+	})
+	g, err := newAxfr(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ns1.example.lan", "www.example.lan"}
+	for _, name := range expected {
+		e, _ := g.Generate(context.Background())
+		if e == nil || e.Source != name {
+			t.Fatalf("expected entry %s, got %v", name, e)
+		}
+	}
+	if e, _ := g.Generate(context.Background()); e != nil {
+		t.Errorf("unexpected entry %v", e)
+	}
+
+	conf.Put("config.tsig.name", "")
+	if _, err := newAxfr(context.Background(), conf); err == nil {
+		t.Error("expected error for unsigned transfer")
+	}
+}
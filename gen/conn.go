@@ -0,0 +1,34 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// dialContext connects to address on network, giving up after timeout or when ctx is done.
+func dialContext(ctx context.Context, network, address string, timeout time.Duration) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout}
+	return d.DialContext(ctx, network, address)
+}
+
+// closeOnDone closes c when ctx is done, aborting any operation blocked on it.
+// The returned function stops watching ctx; it must be called once c is not used anymore.
+func closeOnDone(ctx context.Context, c io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
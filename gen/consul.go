@@ -0,0 +1,254 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("consul", newConsul, Meta{
+		Description: "Services and nodes in the Consul catalog",
+		Keys: []Key{
+			{Name: "config.url", Default: "http://127.0.0.1:8500"},
+			{Name: "config.token", Secret: true},
+			{Name: "config.datacenter"},
+			{Name: "config.services", Type: TypeBool, Default: "true"},
+			{Name: "config.nodes", Type: TypeBool, Default: "true"},
+			{Name: "config.passing", Type: TypeBool, Default: "false"},
+			{Name: "config.timeout", Type: TypeDuration, Default: "10s"},
+			{Name: "config.watch", Type: TypeDuration},
+			{Name: "config.wait", Type: TypeDuration, Default: "5m0s"},
+		},
+	})
+}
+
+// consulClient queries the Consul HTTP API.
+type consulClient struct {
+	url        string
+	token      string
+	datacenter string
+	client     *http.Client
+}
+
+// consulOptions select the entries produced from the Consul catalog.
+type consulOptions struct {
+	services bool
+	nodes    bool
+	passing  bool
+	zone     string
+}
+
+// newConsul returns a generator yielding entries <service>.<zone> for the addresses of
+// the instances of each service and <node>.<zone> for the address of each node in the
+// catalog of the Consul agent at config.url (default http://127.0.0.1:8500). Services and
+// nodes can be excluded with config.services and config.nodes set to false. If config.passing
+// is true, only service instances with all health checks passing are used.
+//
+// If config.watch is set, the catalog is watched using blocking queries waiting at most
+// config.wait (default 5m) for changes; config.watch is the minimum interval between queries.
+func newConsul(ctx context.Context, c *cfg.Config) (Generator, error) {
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := c.GetDuration("config.wait", 0)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := c.GetDuration("config.watch", 0)
+	if err != nil {
+		return nil, err
+	}
+	o := &consulOptions{zone: c.GetVal("dns.zone", "consul")}
+	if o.services, err = c.GetBool("config.services", false); err != nil {
+		return nil, err
+	}
+	if o.nodes, err = c.GetBool("config.nodes", false); err != nil {
+		return nil, err
+	}
+	if o.passing, err = c.GetBool("config.passing", false); err != nil {
+		return nil, err
+	}
+	if !o.services && !o.nodes {
+		return nil, errors.New("consul services and nodes both disabled")
+	}
+	client := &consulClient{
+		url:        strings.TrimSuffix(c.GetVal("config.url", ""), "/"),
+		token:      c.GetVal("config.token", ""),
+		datacenter: c.GetVal("config.datacenter", ""),
+		// Consul adds up to wait/16 to the wait time of blocking queries.
+		client: &http.Client{Timeout: timeout + wait + wait/16},
+	}
+	if interval <= 0 {
+		entries, err := client.entries(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+		return newListgen(entries), nil
+	}
+	return newPoller(ctx, interval, client.loader(o, wait))
+}
+
+// loader returns a function that waits for a change in the catalog, or in the health
+// checks if only passing instances are used, and then loads all entries. The first call
+// does not wait.
+func (c *consulClient) loader(o *consulOptions, wait time.Duration) loadFunc {
+	path := "/v1/catalog/services"
+	if o.passing {
+		path = "/v1/health/state/any"
+	}
+	var index uint64
+	return func(ctx context.Context) ([]*RawEntry, error) {
+		q := url.Values{}
+		if index > 0 {
+			q.Set("index", strconv.FormatUint(index, 10))
+			q.Set("wait", fmt.Sprintf("%ds", int(wait.Seconds())))
+		}
+		idx, err := c.get(ctx, path, q, nil)
+		if err != nil {
+			return nil, err
+		}
+		// The index can go backwards, for example after a restore; start over then.
+		if idx < index {
+			idx = 0
+		}
+		index = idx
+		return c.entries(ctx, o)
+	}
+}
+
+// entries loads the entries for the services and nodes in the catalog.
+func (c *consulClient) entries(ctx context.Context, o *consulOptions) ([]*RawEntry, error) {
+	var entries []*RawEntry
+	if o.services {
+		var services map[string][]string
+		if _, err := c.get(ctx, "/v1/catalog/services", nil, &services); err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(services))
+		for name := range services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			addrs, err := c.serviceAddresses(ctx, name, o.passing)
+			if err != nil {
+				return nil, err
+			}
+			for _, addr := range addrs {
+				entries = append(entries, NewRawEntry(name+"."+o.zone, addr))
+			}
+		}
+	}
+	if o.nodes {
+		var nodes []struct {
+			Node    string
+			Address string
+		}
+		if _, err := c.get(ctx, "/v1/catalog/nodes", nil, &nodes); err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			entries = append(entries, NewRawEntry(n.Node+"."+o.zone, n.Address))
+		}
+	}
+	return entries, nil
+}
+
+// serviceAddresses returns the addresses of the instances of service name, only of those
+// with passing health checks if passing is true. Duplicated addresses are returned once.
+func (c *consulClient) serviceAddresses(ctx context.Context, name string, passing bool) ([]string, error) {
+	var addrs []string
+	if passing {
+		var instances []struct {
+			Node    struct{ Address string }
+			Service struct{ Address string }
+		}
+		q := url.Values{"passing": {"1"}}
+		if _, err := c.get(ctx, "/v1/health/service/"+url.PathEscape(name), q, &instances); err != nil {
+			return nil, err
+		}
+		for _, in := range instances {
+			addrs = append(addrs, serviceAddress(in.Service.Address, in.Node.Address))
+		}
+	} else {
+		var instances []struct {
+			Address        string
+			ServiceAddress string
+		}
+		if _, err := c.get(ctx, "/v1/catalog/service/"+url.PathEscape(name), nil, &instances); err != nil {
+			return nil, err
+		}
+		for _, in := range instances {
+			addrs = append(addrs, serviceAddress(in.ServiceAddress, in.Address))
+		}
+	}
+	seen := make(map[string]bool)
+	unique := addrs[:0]
+	for _, addr := range addrs {
+		if !seen[addr] {
+			seen[addr] = true
+			unique = append(unique, addr)
+		}
+	}
+	return unique, nil
+}
+
+// serviceAddress returns the address of a service instance, which defaults to the address of its node.
+func serviceAddress(service, node string) string {
+	if service != "" {
+		return service
+	}
+	return node
+}
+
+// get decodes the JSON document at path with query q into v, if v is not nil,
+// and returns the index of the result for blocking queries.
+func (c *consulClient) get(ctx context.Context, path string, q url.Values, v interface{}) (uint64, error) {
+	if q == nil {
+		q = url.Values{}
+	}
+	if c.datacenter != "" {
+		q.Set("dc", c.datacenter)
+	}
+	u := c.url + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return 0, fmt.Errorf("invalid consul request: %s", err)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("cannot query consul: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("cannot query consul %s: %s", path, resp.Status)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return 0, fmt.Errorf("cannot read consul %s: %s", path, err)
+		}
+	}
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return index, nil
+}
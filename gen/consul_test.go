@@ -0,0 +1,189 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul serves a catalog whose web service instances can be changed.
+type fakeConsul struct {
+	mux     sync.Mutex
+	index   int
+	web     string
+	changed chan struct{}
+}
+
+func (f *fakeConsul) setWeb(instances string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.index++
+	f.web = instances
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "s3cr3t" {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	f.mux.Lock()
+	if r.URL.Query().Get("index") == fmt.Sprintf("%d", f.index) {
+		changed := f.changed
+		f.mux.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		f.mux.Lock()
+	}
+	defer f.mux.Unlock()
+	w.Header().Set("X-Consul-Index", fmt.Sprintf("%d", f.index))
+	switch r.URL.Path {
+	case "/v1/catalog/services", "/v1/health/state/any":
+		fmt.Fprint(w, `{"consul": [], "web": ["http"]}`)
+	case "/v1/catalog/service/consul":
+		fmt.Fprint(w, `[{"Node": "server1", "Address": "10.0.0.1", "ServiceAddress": ""}]`)
+	case "/v1/catalog/service/web":
+		fmt.Fprint(w, f.web)
+	case "/v1/health/service/consul":
+		fmt.Fprint(w, `[{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": ""}}]`)
+	case "/v1/health/service/web":
+		if r.URL.Query().Get("passing") == "" {
+			http.Error(w, "passing filter missing", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `[{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.1.0.2"}}]`)
+	case "/v1/catalog/nodes":
+		fmt.Fprint(w, `[{"Node": "server1", "Address": "10.0.0.1"}, {"Node": "worker1", "Address": "10.0.0.2"}]`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func checkEntries(t *testing.T, g Generator, expected []RawEntry) {
+	for _, exp := range expected {
+		e, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil || *e != exp {
+			t.Fatalf("expected %v, got %v", exp, e)
+		}
+	}
+	if e, _ := g.Generate(context.Background()); e != nil {
+		t.Errorf("unexpected entry %v", e)
+	}
+}
+
+func TestConsul(t *testing.T) {
+	fc := &fakeConsul{
+		web:     `[{"Address": "10.0.0.2", "ServiceAddress": "10.1.0.2"}, {"Address": "10.0.0.3", "ServiceAddress": ""}]`,
+		changed: make(chan struct{}),
+	}
+	ts := httptest.NewServer(fc)
+	defer ts.Close()
+
+	conf := map[string]string{
+		"dns.zone":     "test.lan",
+		"config.url":   ts.URL,
+		"config.token": "s3cr3t",
+	}
+	g, err := newConsul(context.Background(), typeConfig("consul", conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, g, []RawEntry{
+		{Source: "consul.test.lan", Target: "10.0.0.1"},
+		{Source: "web.test.lan", Target: "10.1.0.2"},
+		{Source: "web.test.lan", Target: "10.0.0.3"},
+		{Source: "server1.test.lan", Target: "10.0.0.1"},
+		{Source: "worker1.test.lan", Target: "10.0.0.2"},
+	})
+
+	conf["config.passing"] = "true"
+	conf["config.nodes"] = "false"
+	g, err = newConsul(context.Background(), typeConfig("consul", conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, g, []RawEntry{
+		{Source: "consul.test.lan", Target: "10.0.0.1"},
+		{Source: "web.test.lan", Target: "10.1.0.2"},
+	})
+}
+
+func TestConsulWatch(t *testing.T) {
+	fc := &fakeConsul{
+		index:   7,
+		web:     `[{"Address": "10.0.0.2", "ServiceAddress": ""}]`,
+		changed: make(chan struct{}),
+	}
+	ts := httptest.NewServer(fc)
+	defer ts.Close()
+
+	g, err := newConsul(context.Background(), typeConfig("consul", map[string]string{
+		"dns.zone":        "test.lan",
+		"config.url":      ts.URL,
+		"config.token":    "s3cr3t",
+		"config.nodes":    "false",
+		"config.watch":    "1ms",
+		"config.wait":     "10s",
+		"config.timeout":  "1s",
+		"config.services": "true",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := g.(Watcher)
+	if !ok {
+		t.Fatalf("expected a watcher, got %T", g)
+	}
+	checkEntries(t, w, []RawEntry{
+		{Source: "consul.test.lan", Target: "10.0.0.1"},
+		{Source: "web.test.lan", Target: "10.0.0.2"},
+	})
+	ch := w.Watch()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		fc.setWeb(`[{"Address": "10.0.0.3", "ServiceAddress": ""}]`)
+	}()
+	expected := []Delta{
+		{Op: OpRemove, Entry: NewRawEntry("web.test.lan", "10.0.0.2")},
+		{Op: OpAdd, Entry: NewRawEntry("web.test.lan", "10.0.0.3")},
+	}
+	for _, exp := range expected {
+		d := <-ch
+		if d.Err != nil || d.Op != exp.Op || *d.Entry != *exp.Entry {
+			t.Fatalf("expected %v %v, got %v %v (%v)", exp.Op, exp.Entry, d.Op, d.Entry, d.Err)
+		}
+	}
+	// Stop must cancel the pending blocking query.
+	w.Close()
+	select {
+	case <-drain(ch):
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher not stopped")
+	}
+}
+
+// drain consumes ch and returns a channel closed when ch is closed.
+func drain(ch <-chan *Delta) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("csv", newCsvgen, Meta{
+		Description: "Names and targets in columns of a CSV file",
+		Keys: append([]Key{
+			{Name: "config.path", Required: true},
+			{Name: "config.watch", Type: TypeDuration},
+		}, csvKeys...),
+	})
+}
+
+// csvOptions describe how to read entries from CSV or TSV data.
+type csvOptions struct {
+	delim  rune
+	header bool
+	name   int
+	target int
+}
+
+// csvKeys are the configuration keys read by newCsvOptions.
+var csvKeys = []Key{
+	{Name: "config.delimiter", Default: ","},
+	{Name: "config.header", Type: TypeBool, Default: "false"},
+	{Name: "config.column.name", Type: TypeInt, Default: "0"},
+	{Name: "config.column.target", Type: TypeInt, Default: "1"},
+}
+
+// newCsvOptions reads the CSV options from c: config.delimiter (a single character
+// or "tab"), config.header (whether to skip the first row) and the zero-based
+// indexes config.column.name and config.column.target.
+func newCsvOptions(c *cfg.Config) (*csvOptions, error) {
+	var err error
+	o := &csvOptions{delim: ','}
+	switch d := c.GetVal("config.delimiter", ""); d {
+	case "tab", `\t`:
+		o.delim = '\t'
+	default:
+		r, n := utf8.DecodeRuneInString(d)
+		if n == 0 || n != len(d) {
+			return nil, fmt.Errorf("invalid delimiter '%s'", d)
+		}
+		o.delim = r
+	}
+	if o.header, err = c.GetBool("config.header", false); err != nil {
+		return nil, err
+	}
+	if o.name, err = c.GetInt("config.column.name", 0); err != nil {
+		return nil, err
+	}
+	if o.target, err = c.GetInt("config.column.target", 0); err != nil {
+		return nil, err
+	}
+	if o.name < 0 || o.target < 0 {
+		return nil, errors.New("column indexes cannot be negative")
+	}
+	return o, nil
+}
+
+// parseCsv reads all entries from r. Names without dots are considered to be inside zone.
+func parseCsv(r io.Reader, o *csvOptions, zone string) ([]*RawEntry, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = o.delim
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	ncols := o.name + 1
+	if o.target >= ncols {
+		ncols = o.target + 1
+	}
+	entries := make([]*RawEntry, 0)
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && o.header {
+			continue
+		}
+		if len(row) < ncols {
+			return nil, fmt.Errorf("row %d: expected at least %d columns, got %d", line, ncols, len(row))
+		}
+		if row[o.name] == "" && row[o.target] == "" {
+			continue
+		}
+		entries = append(entries, NewRawEntry(qualify(row[o.name], zone), row[o.target]))
+	}
+	return entries, nil
+}
+
+// newCsvgen returns a generator yielding entries from the CSV or TSV file at config.path.
+func newCsvgen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	path, ok := c.Get("config.path")
+	if !ok || path == "" {
+		return nil, errors.New("csv file path not specified")
+	}
+	return newFilegen(ctx, c, path, "csv", "csv file")
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCsv(t *testing.T) {
+	conf := typeConfig("csv", map[string]string{
+		"config.delimiter":     "tab",
+		"config.header":        "true",
+		"config.column.name":   "0",
+		"config.column.target": "2",
+	})
+	o, err := newCsvOptions(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "name\towner\taddress\n" +
+		"# a comment\n" +
+		"printer\tops\t10.0.0.5\n" +
+		"wiki.example.lan\tdev\twww.example.com\n"
+	entries, err := parseCsv(strings.NewReader(data), o, "example.lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RawEntry{
+		{Source: "printer.example.lan", Target: "10.0.0.5"},
+		{Source: "wiki.example.lan", Target: "www.example.com"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i := range expected {
+		if *entries[i] != expected[i] {
+			t.Errorf("entry %d: expected %v, got %v", i, expected[i], *entries[i])
+		}
+	}
+}
+
+func TestParseCsvShortRow(t *testing.T) {
+	o, err := newCsvOptions(typeConfig("csv", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseCsv(strings.NewReader("a.lan,1.2.3.4\nb.lan\n"), o, "lan"); err == nil {
+		t.Error("expected error for row with missing target column")
+	}
+}
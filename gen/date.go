@@ -5,22 +5,35 @@
 package gen
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dullgiulio/kuradns/cfg"
 )
 
+func init() {
+	Register("date", func(_ context.Context, c *cfg.Config) (Generator, error) {
+		return newDategen(c), nil
+	}, Meta{
+		Description: "A single entry named after the current date, for testing",
+	})
+}
+
 // dategen is a generator that yields entries containing the date. Used for testing.
 type dategen struct {
-	ch   chan *RawEntry
-	date string
-	zone string
+	ch     chan *RawEntry
+	done   chan struct{}
+	closed sync.Once
+	date   string
+	zone   string
 }
 
 func newDategen(c *cfg.Config) *dategen {
 	d := &dategen{
 		ch:   make(chan *RawEntry),
+		done: make(chan struct{}),
 		date: time.Now().UTC().Format("20060102150405"),
 		zone: c.GetVal("dns.zone", "lan"),
 	}
@@ -29,10 +42,25 @@ func newDategen(c *cfg.Config) *dategen {
 }
 
 func (d *dategen) run() {
-	d.ch <- NewRawEntry(fmt.Sprintf("%s.%s", d.date, d.zone), "127.0.0.1")
-	close(d.ch)
+	defer close(d.ch)
+	select {
+	case d.ch <- NewRawEntry(fmt.Sprintf("%s.%s", d.date, d.zone), "127.0.0.1"):
+	case <-d.done:
+	}
+}
+
+func (d *dategen) Generate(ctx context.Context) (*RawEntry, error) {
+	select {
+	case e := <-d.ch:
+		return e, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
-func (d *dategen) Generate() (*RawEntry, error) {
-	return <-d.ch, nil
+func (d *dategen) Close() error {
+	d.closed.Do(func() {
+		close(d.done)
+	})
+	return nil
 }
@@ -0,0 +1,251 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("dhcp", newDhcpgen, Meta{
+		Description: "Hostnames of unexpired leases in a dnsmasq or ISC dhcpd leases file",
+		Keys: []Key{
+			{Name: "config.path", Required: true},
+			{Name: "config.format", Default: "dnsmasq", Values: []string{"dnsmasq", "dhcpd"}},
+			{Name: "config.watch", Type: TypeDuration},
+		},
+	})
+}
+
+// lease is an address assigned by a DHCP server to a host.
+type lease struct {
+	ip       string
+	hostname string
+	// Zero for leases that do not expire
+	expiry time.Time
+}
+
+// expiresBefore returns true if l expires before o. Leases that do not expire
+// expire after all others.
+func (l *lease) expiresBefore(o *lease) bool {
+	if l.expiry.IsZero() {
+		return false
+	}
+	return o.expiry.IsZero() || l.expiry.Before(o.expiry)
+}
+
+// leases are DHCP leases keyed by IP address.
+type leases map[string]*lease
+
+// newDhcpgen returns a generator yielding an entry for each named host with an
+// unexpired lease in the DHCP server leases file at config.path. config.format is
+// "dnsmasq" (default) or "dhcpd" for the ISC DHCP server. If config.watch is set,
+// the file is checked for changes and expired leases at that interval.
+func newDhcpgen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	path, ok := c.Get("config.path")
+	if !ok || path == "" {
+		return nil, errors.New("leases file path not specified")
+	}
+	format := c.GetVal("config.format", "")
+	if format != "dnsmasq" && format != "dhcpd" {
+		return nil, fmt.Errorf("unknown leases format '%s'", format)
+	}
+	interval, err := c.GetDuration("config.watch", 0)
+	if err != nil {
+		return nil, err
+	}
+	load := leasesLoader(path, format, c.GetVal("dns.zone", "lan"))
+	if interval > 0 {
+		return newPoller(ctx, interval, load)
+	}
+	entries, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newListgen(entries), nil
+}
+
+// leasesLoader returns a function that reads the leases file at path, only when
+// it changed, and returns the entries for the leases that have not yet expired.
+func leasesLoader(path, format, zone string) loadFunc {
+	var (
+		ls    leases
+		mtime time.Time
+		size  int64 = -1
+	)
+	return func(context.Context) ([]*RawEntry, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open leases file: %s", err)
+		}
+		if !fi.ModTime().Equal(mtime) || fi.Size() != size {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot open leases file: %s", err)
+			}
+			defer f.Close()
+			if format == "dhcpd" {
+				ls, err = parseDhcpdLeases(f)
+			} else {
+				ls, err = parseDnsmasqLeases(f)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot read leases file %s: %s", path, err)
+			}
+			mtime, size = fi.ModTime(), fi.Size()
+		}
+		return ls.entries(time.Now(), zone), nil
+	}
+}
+
+// entries returns the entries for the leases valid at now, sorted by name. If a
+// hostname has more than one lease, the one expiring last is used.
+func (ls leases) entries(now time.Time, zone string) []*RawEntry {
+	byName := make(map[string]*lease)
+	for _, l := range ls {
+		if l.hostname == "" || (!l.expiry.IsZero() && !l.expiry.After(now)) {
+			continue
+		}
+		if prev, ok := byName[l.hostname]; ok && l.expiresBefore(prev) {
+			continue
+		}
+		byName[l.hostname] = l
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]*RawEntry, len(names))
+	for i, name := range names {
+		entries[i] = NewRawEntry(qualify(name, zone), byName[name].ip)
+	}
+	return entries
+}
+
+// parseDnsmasqLeases reads a dnsmasq leases file. Each line holds the expiry time in
+// seconds since the epoch (zero for infinite leases), the MAC address, the IP address,
+// the hostname ("*" if unknown) and the client ID.
+func parseDnsmasqLeases(r io.Reader) (leases, error) {
+	ls := make(leases)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		// DHCPv6 server DUID
+		if len(fields) == 0 || fields[0] == "duid" {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 fields", line)
+		}
+		secs, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry '%s'", line, fields[0])
+		}
+		if net.ParseIP(fields[2]) == nil {
+			return nil, fmt.Errorf("line %d: invalid address '%s'", line, fields[2])
+		}
+		l := &lease{ip: fields[2]}
+		if secs != 0 {
+			l.expiry = time.Unix(secs, 0)
+		}
+		if fields[3] != "*" {
+			l.hostname = fields[3]
+		}
+		ls[l.ip] = l
+	}
+	return ls, s.Err()
+}
+
+// parseDhcpdLeases reads an ISC dhcpd leases file. Later declarations of a lease
+// replace earlier ones. Only leases in active state are returned.
+func parseDhcpdLeases(r io.Reader) (leases, error) {
+	ls := make(leases)
+	s := bufio.NewScanner(r)
+	var (
+		cur    *lease
+		active bool
+	)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		if cur == nil {
+			fields := strings.Fields(text)
+			if len(fields) == 3 && fields[0] == "lease" && fields[2] == "{" {
+				if net.ParseIP(fields[1]) == nil {
+					return nil, fmt.Errorf("line %d: invalid address '%s'", line, fields[1])
+				}
+				cur, active = &lease{ip: fields[1]}, true
+			}
+			// Other declarations (server-duid, host, etc.) are ignored.
+			continue
+		}
+		if text == "}" {
+			if active {
+				ls[cur.ip] = cur
+			} else {
+				delete(ls, cur.ip)
+			}
+			cur = nil
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(text, ";"))
+		switch {
+		case fields[0] == "ends" && len(fields) >= 2:
+			t, err := parseDhcpdTime(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			cur.expiry = t
+		case fields[0] == "binding" && len(fields) == 3 && fields[1] == "state":
+			active = fields[2] == "active"
+		case fields[0] == "client-hostname" && len(fields) == 2:
+			cur.hostname = strings.Trim(fields[1], `"`)
+		}
+	}
+	if cur != nil {
+		return nil, errors.New("unterminated lease declaration")
+	}
+	return ls, s.Err()
+}
+
+// parseDhcpdTime parses the fields of a date in a dhcpd leases file: "never",
+// "epoch SECONDS" or "WEEKDAY YYYY/MM/DD HH:MM:SS" in UTC.
+func parseDhcpdTime(fields []string) (time.Time, error) {
+	switch {
+	case fields[0] == "never":
+		return time.Time{}, nil
+	case fields[0] == "epoch" && len(fields) == 2:
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", strings.Join(fields, " "))
+		}
+		return time.Unix(secs, 0), nil
+	case len(fields) == 3:
+		t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", strings.Join(fields, " "))
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", strings.Join(fields, " "))
+}
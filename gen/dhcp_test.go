@@ -0,0 +1,110 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkLeaseEntries(t *testing.T, ls leases, now time.Time, expected []RawEntry) {
+	entries := ls.entries(now, "lan")
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d: %v", len(expected), len(entries), entries)
+	}
+	for i := range expected {
+		if *entries[i] != expected[i] {
+			t.Errorf("entry %d: expected %v, got %v", i, expected[i], *entries[i])
+		}
+	}
+}
+
+func TestDnsmasqLeases(t *testing.T) {
+	data := `1500000000 00:11:22:33:44:55 10.0.0.10 laptop 01:00:11:22:33:44:55
+1400000000 00:11:22:33:44:66 10.0.0.11 phone *
+0 00:11:22:33:44:77 10.0.0.12 printer *
+1500000000 00:11:22:33:44:88 10.0.0.13 * *
+duid 00:01:00:01:1f:aa:bb:cc:00:11:22:33:44:55
+`
+	ls, err := parseDnsmasqLeases(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseEntries(t, ls, time.Unix(1450000000, 0), []RawEntry{
+		{Source: "laptop.lan", Target: "10.0.0.10"},
+		{Source: "printer.lan", Target: "10.0.0.12"},
+	})
+	checkLeaseEntries(t, ls, time.Unix(1600000000, 0), []RawEntry{
+		{Source: "printer.lan", Target: "10.0.0.12"},
+	})
+}
+
+func TestLeasesInfinite(t *testing.T) {
+	expiry := time.Unix(1500000000, 0)
+	ls := leases{
+		"10.0.0.30": {ip: "10.0.0.30", hostname: "nas"},
+		"10.0.0.31": {ip: "10.0.0.31", hostname: "nas", expiry: expiry},
+		"10.0.0.40": {ip: "10.0.0.40", hostname: "tv", expiry: expiry},
+		"10.0.0.41": {ip: "10.0.0.41", hostname: "tv"},
+	}
+	// Leases are visited in random order
+	for i := 0; i < 20; i++ {
+		checkLeaseEntries(t, ls, time.Unix(1450000000, 0), []RawEntry{
+			{Source: "nas.lan", Target: "10.0.0.30"},
+			{Source: "tv.lan", Target: "10.0.0.41"},
+		})
+	}
+}
+
+func TestDhcpdLeases(t *testing.T) {
+	data := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+server-duid "\000\001\000\001";
+
+lease 10.0.0.20 {
+  starts 4 2016/01/01 10:00:00;
+  ends 4 2016/01/01 22:00:00;
+  binding state active;
+  hardware ethernet 00:11:22:33:44:55;
+  client-hostname "desktop";
+}
+lease 10.0.0.21 {
+  starts 4 2016/01/01 10:00:00;
+  ends epoch 1451685600; # 2016/01/01 22:00:00
+  binding state free;
+  client-hostname "old";
+}
+lease 10.0.0.22 {
+  ends never;
+  binding state active;
+  client-hostname "server";
+}
+lease 10.0.0.20 {
+  starts 4 2016/01/01 12:00:00;
+  ends 5 2016/01/02 00:00:00;
+  binding state active;
+  client-hostname "desktop";
+}
+lease 10.0.0.23 {
+  ends 4 2016/01/01 20:00:00;
+  binding state active;
+  client-hostname "desktop";
+}
+`
+	ls, err := parseDhcpdLeases(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseEntries(t, ls, time.Date(2016, 1, 1, 21, 0, 0, 0, time.UTC), []RawEntry{
+		{Source: "desktop.lan", Target: "10.0.0.20"},
+		{Source: "server.lan", Target: "10.0.0.22"},
+	})
+	checkLeaseEntries(t, ls, time.Date(2016, 1, 2, 1, 0, 0, 0, time.UTC), []RawEntry{
+		{Source: "server.lan", Target: "10.0.0.22"},
+	})
+	if _, err := parseDhcpdLeases(strings.NewReader("lease 10.0.0.1 {\n ends soon;\n}\n")); err == nil {
+		t.Error("expected error for invalid date")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("dir", newDirgen, Meta{
+		Description: "Entries from all files in a directory, watched for changes",
+		Keys: withFormatKeys(
+			Key{Name: "config.path", Required: true},
+			Key{Name: "config.format", Default: "hosts", Values: formatNames},
+			Key{Name: "config.watch", Type: TypeDuration, Default: defaultDirWatch.String()},
+		),
+	})
+}
+
+// Default interval between checks of a watched directory.
+const defaultDirWatch = 10 * time.Second
+
+// newDirgen returns a generator yielding the entries of all files in the directory
+// at config.path. The format of each file is given by its extension; files with
+// other extensions are read in config.format (by default hosts). The directory is
+// checked for added, changed or removed files every config.watch; a zero interval
+// disables watching.
+func newDirgen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	path, ok := c.Get("config.path")
+	if !ok || path == "" {
+		return nil, errors.New("directory path not specified")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open directory: %s", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	interval, err := c.GetDuration("config.watch", 0)
+	if err != nil {
+		return nil, err
+	}
+	load := dirLoader(path, c.GetVal("config.format", ""), c)
+	if interval > 0 {
+		return newPoller(ctx, interval, load)
+	}
+	entries, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newListgen(entries), nil
+}
+
+// dirLoader returns a function that reads the entries from all files in dir. The
+// function returns errUnchanged if no file was added, removed or modified since the
+// last successful read.
+func dirLoader(dir, format string, c *cfg.Config) loadFunc {
+	var last string
+	return func(context.Context) ([]*RawEntry, error) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read directory: %s", err)
+		}
+		var sig strings.Builder
+		names := make([]string, 0, len(files))
+		for _, fi := range files {
+			if !fi.Mode().IsRegular() || skipFile(fi.Name()) {
+				continue
+			}
+			names = append(names, fi.Name())
+			fmt.Fprintf(&sig, "%s\x00%d\x00%d\x00", fi.Name(), fi.Size(), fi.ModTime().UnixNano())
+		}
+		if sig.String() == last {
+			return nil, errUnchanged
+		}
+		entries := make([]*RawEntry, 0)
+		for _, name := range names {
+			es, err := parseFile(filepath.Join(dir, name), fileFormat(name, format), "file", c)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, es...)
+		}
+		last = sig.String()
+		return entries, nil
+	}
+}
+
+// skipFile returns true for hidden files and backup files left by editors.
+func skipFile(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestDirLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kuradns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("web", "10.0.0.1 web\n")
+	write("db.json", `[{"name": "db", "target": "10.0.0.2"}]`)
+	write(".web.swp", "garbage")
+	write("web~", "10.0.0.9 old\n")
+
+	load := dirLoader(dir, "hosts", cfg.FromMap(map[string]string{"dns.zone": "lan"}))
+	names := func(entries []*RawEntry) []string {
+		var ns []string
+		for _, e := range entries {
+			ns = append(ns, e.Source)
+		}
+		sort.Strings(ns)
+		return ns
+	}
+	entries, err := load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := names(entries); len(ns) != 2 || ns[0] != "db.lan" || ns[1] != "web.lan" {
+		t.Errorf("unexpected entries %v", ns)
+	}
+	if _, err := load(context.Background()); err != errUnchanged {
+		t.Errorf("expected unchanged directory, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "db.json")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := names(entries); len(ns) != 1 || ns[0] != "web.lan" {
+		t.Errorf("unexpected entries after removal %v", ns)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("docker", newDockergen, Meta{
+		Description: "Running Docker containers and their label aliases",
+		Keys: []Key{
+			{Name: "config.socket", Default: "/var/run/docker.sock"},
+			{Name: "config.network"},
+			{Name: "config.label", Default: dockerAliasLabel},
+			{Name: "config.timeout", Type: TypeDuration, Default: "10s"},
+		},
+	})
+}
+
+// Default label listing additional names of a container.
+const dockerAliasLabel = "kuradns.aliases"
+
+// dockerContainer is the part of a container in the Docker Engine API container list used here.
+type dockerContainer struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// newDockergen returns a generator yielding an entry <container>.<zone> for each
+// running container of the Docker daemon listening on config.socket (default
+// /var/run/docker.sock). Names separated by commas or spaces in the container label
+// config.label (default kuradns.aliases) are added as aliases; aliases without dots
+// are placed under the zone. Only addresses in network config.network are used if set,
+// otherwise the addresses of the first network, by name, with any.
+func newDockergen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	socket := c.GetVal("config.socket", "")
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	label := c.GetVal("config.label", "")
+	network := c.GetVal("config.network", "")
+	zone := c.GetVal("dns.zone", "docker")
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialContext(ctx, "unix", socket, timeout)
+			},
+		},
+	}
+	// The host is ignored, all requests go to the socket.
+	req, err := http.NewRequest("GET", "http://docker/containers/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker request: %s", err)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list containers: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot list containers: %s", resp.Status)
+	}
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("cannot read containers list: %s", err)
+	}
+	var entries []*RawEntry
+	for i := range containers {
+		entries = append(entries, containerEntries(&containers[i], network, label, zone)...)
+	}
+	return newListgen(entries), nil
+}
+
+// containerEntries returns the entries for the names and aliases of container ct.
+func containerEntries(ct *dockerContainer, network, label, zone string) []*RawEntry {
+	ips := containerIPs(ct, network)
+	if len(ips) == 0 {
+		return nil
+	}
+	var names []string
+	for _, name := range ct.Names {
+		// Names of linked containers contain the linking container name.
+		name = strings.TrimPrefix(name, "/")
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		names = append(names, name+"."+zone)
+	}
+	aliases := strings.FieldsFunc(ct.Labels[label], func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	for _, alias := range aliases {
+		names = append(names, qualify(alias, zone))
+	}
+	var entries []*RawEntry
+	for _, name := range names {
+		for _, ip := range ips {
+			entries = append(entries, NewRawEntry(name, ip))
+		}
+	}
+	return entries
+}
+
+// containerIPs returns the addresses of container ct in network, or in its first
+// network with addresses if network is empty.
+func containerIPs(ct *dockerContainer, network string) []string {
+	nets := ct.NetworkSettings.Networks
+	names := make([]string, 0, len(nets))
+	for name := range nets {
+		if network == "" || name == network {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var ips []string
+		if ip := nets[name].IPAddress; ip != "" {
+			ips = append(ips, ip)
+		}
+		if ip := nets[name].GlobalIPv6Address; ip != "" {
+			ips = append(ips, ip)
+		}
+		if len(ips) > 0 {
+			return ips
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const dockerContainersJSON = `[
+  {"Id": "a1", "Names": ["/web", "/db/web"], "Labels": {"kuradns.aliases": "www, api.example.lan"},
+   "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2", "GlobalIPv6Address": ""}}}},
+  {"Id": "b2", "Names": ["/db"], "Labels": {},
+   "NetworkSettings": {"Networks": {
+     "backend": {"IPAddress": "172.18.0.3", "GlobalIPv6Address": "fd00::3"},
+     "bridge": {"IPAddress": "172.17.0.3", "GlobalIPv6Address": ""}}}},
+  {"Id": "c3", "Names": ["/builder"], "Labels": {},
+   "NetworkSettings": {"Networks": {"none": {"IPAddress": "", "GlobalIPv6Address": ""}}}}
+]`
+
+func fakeDocker(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kuradns-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, dockerContainersJSON)
+	}))
+	return socket, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDockergen(t *testing.T) {
+	socket, cleanup := fakeDocker(t)
+	defer cleanup()
+
+	tests := []struct {
+		network  string
+		expected []RawEntry
+	}{
+		{"", []RawEntry{
+			{Source: "web.test.lan", Target: "172.17.0.2"},
+			{Source: "www.test.lan", Target: "172.17.0.2"},
+			{Source: "api.example.lan", Target: "172.17.0.2"},
+			{Source: "db.test.lan", Target: "172.18.0.3"},
+			{Source: "db.test.lan", Target: "fd00::3"},
+		}},
+		{"bridge", []RawEntry{
+			{Source: "web.test.lan", Target: "172.17.0.2"},
+			{Source: "www.test.lan", Target: "172.17.0.2"},
+			{Source: "api.example.lan", Target: "172.17.0.2"},
+			{Source: "db.test.lan", Target: "172.17.0.3"},
+		}},
+	}
+	for _, tt := range tests {
+		g, err := newDockergen(context.Background(), typeConfig("docker", map[string]string{
+			"dns.zone":       "test.lan",
+			"config.socket":  socket,
+			"config.network": tt.network,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, exp := range tt.expected {
+			e, err := g.Generate(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e == nil || *e != exp {
+				t.Fatalf("network %q: expected %v, got %v", tt.network, exp, e)
+			}
+		}
+		if e, _ := g.Generate(context.Background()); e != nil {
+			t.Errorf("network %q: unexpected entry %v", tt.network, e)
+		}
+	}
+}
+
+func TestDockergenUnreachable(t *testing.T) {
+	_, err := newDockergen(context.Background(), typeConfig("docker", map[string]string{
+		"config.socket": "/nonexistent/docker.sock",
+	}))
+	if err == nil {
+		t.Error("expected error for missing socket")
+	}
+}
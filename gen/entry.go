@@ -4,17 +4,93 @@
 
 package gen
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
 // RawEntry is a pair of source and target addresses or domains to be resolved by the DNS server.
 type RawEntry struct {
 	Source, Target string
+	// Type is the DNS record type; if empty, the type is deduced from the target.
+	Type string
+	// TTL overrides the server TTL if non-zero.
+	TTL time.Duration
+	// Priority is the preference of MX records and the priority of SRV records.
+	Priority uint16
+	// Weight and Port are the weight and port of SRV records.
+	Weight, Port uint16
+	// Data is the text of TXT records or, for the other types not listed above,
+	// the record data in zone file format (e.g. "0 issue \"ca.example\"" for CAA).
+	Data string
 }
 
 // MakeRawEntry allocates a raw entry for source s and target t.
 func NewRawEntry(s, t string) *RawEntry {
-	return &RawEntry{s, t}
+	return &RawEntry{Source: s, Target: t}
 }
 
 // EmptyRawEntry allocates an empty raw entry.
 func EmptyRawEntry() *RawEntry {
 	return &RawEntry{}
 }
+
+// ParseType returns the canonical name of record type t or an error if t
+// is not supported. An empty type is valid.
+func ParseType(t string) (string, error) {
+	t = strings.ToUpper(t)
+	switch t {
+	case "", "A", "AAAA", "CNAME", "TXT", "MX", "SRV":
+		return t, nil
+	// The zone authority is served by kuradns itself; the others are not records.
+	case "SOA", "NS", "ANY", "AXFR", "IXFR", "MAILA", "MAILB", "OPT", "TSIG", "TKEY":
+		return "", fmt.Errorf("unsupported record type '%s'", t)
+	}
+	if _, ok := dns.StringToType[t]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown record type '%s'", t)
+}
+
+// Generic returns true if records of type t are made from their data in zone file format.
+func Generic(t string) bool {
+	switch t {
+	case "", "A", "AAAA", "CNAME", "TXT", "MX", "SRV":
+		return false
+	}
+	return true
+}
+
+// Check verifies that the fields needed by the type of e are set.
+func (e *RawEntry) Check() error {
+	if e.Source == "" {
+		return errors.New("name not specified")
+	}
+	if e.Type == "TXT" || Generic(e.Type) {
+		if e.Data == "" {
+			return fmt.Errorf("%s: %s record without data", e.Source, e.Type)
+		}
+		return nil
+	}
+	if e.Target == "" {
+		return fmt.Errorf("%s: target not specified", e.Source)
+	}
+	return nil
+}
+
+// ParseTTL parses a TTL given either as a number of seconds or as a duration.
+func ParseTTL(s string) (time.Duration, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid TTL '%s'", s)
+	}
+	return d, nil
+}
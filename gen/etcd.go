@@ -0,0 +1,169 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("etcd", newEtcd, Meta{
+		Description: "Keys under a prefix in etcd, through the v3 HTTP gateway",
+		Keys: []Key{
+			{Name: "config.prefix", Required: true},
+			{Name: "config.url", Default: "http://127.0.0.1:2379"},
+			{Name: "config.api", Default: "v3"},
+			{Name: "config.user"},
+			{Name: "config.password", Secret: true},
+			{Name: "config.timeout", Type: TypeDuration, Default: "10s"},
+		},
+	})
+}
+
+// Maximum number of keys requested in a single range call.
+const etcdRangeLimit = 1000
+
+// etcdClient calls the etcd v3 HTTP gateway.
+type etcdClient struct {
+	ctx    context.Context
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newEtcd returns a generator yielding an entry for each key under config.prefix in etcd,
+// read through the v3 HTTP gateway at config.url (default http://127.0.0.1:2379). The name is
+// the key without the prefix and the target is the value. If config.user is set, the client
+// authenticates with config.password. config.api is the gateway API version (default v3).
+func newEtcd(ctx context.Context, c *cfg.Config) (Generator, error) {
+	prefix, ok := c.Get("config.prefix")
+	if !ok || prefix == "" {
+		return nil, errors.New("etcd key prefix not specified")
+	}
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	ec := &etcdClient{
+		ctx:    ctx,
+		url:    strings.TrimSuffix(c.GetVal("config.url", ""), "/") + "/" + c.GetVal("config.api", ""),
+		client: &http.Client{Timeout: timeout},
+	}
+	if user, ok := c.Get("config.user"); ok && user != "" {
+		if err := ec.authenticate(user, c.GetVal("config.password", "")); err != nil {
+			return nil, err
+		}
+	}
+	kvs, err := ec.rangePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return newListgen(kvEntries(kvs, prefix, c.GetVal("dns.zone", "lan"))), nil
+}
+
+// authenticate obtains a token for user.
+func (ec *etcdClient) authenticate(user, password string) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := ec.post("/auth/authenticate", map[string]string{"name": user, "password": password}, &resp); err != nil {
+		return fmt.Errorf("cannot authenticate to etcd: %s", err)
+	}
+	ec.token = resp.Token
+	return nil
+}
+
+// rangePrefix returns all keys starting with prefix and their values.
+func (ec *etcdClient) rangePrefix(prefix string) (map[string]string, error) {
+	end := base64.StdEncoding.EncodeToString(prefixEnd([]byte(prefix)))
+	key := []byte(prefix)
+	kvs := make(map[string]string)
+	for {
+		req := map[string]interface{}{
+			"key":       base64.StdEncoding.EncodeToString(key),
+			"range_end": end,
+			"limit":     etcdRangeLimit,
+		}
+		var resp struct {
+			Kvs []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"kvs"`
+			More bool `json:"more"`
+		}
+		if err := ec.post("/kv/range", req, &resp); err != nil {
+			return nil, fmt.Errorf("cannot read etcd keys: %s", err)
+		}
+		for _, kv := range resp.Kvs {
+			k, err := base64.StdEncoding.DecodeString(kv.Key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid etcd key: %s", err)
+			}
+			v, err := base64.StdEncoding.DecodeString(kv.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid etcd value for %s: %s", k, err)
+			}
+			kvs[string(k)] = string(v)
+			key = append(k, 0)
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return kvs, nil
+		}
+	}
+}
+
+// post sends req as JSON to the gateway at path and decodes the result into resp.
+func (ec *etcdClient) post(path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", ec.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if ec.token != "" {
+		r.Header.Set("Authorization", ec.token)
+	}
+	res, err := ec.client.Do(r.WithContext(ec.ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(res.Body).Decode(&e) == nil && e.Error != "" {
+			return fmt.Errorf("%s: %s", res.Status, e.Error)
+		}
+		return errors.New(res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// prefixEnd returns the end of the range of keys starting with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// All keys
+	return []byte{0}
+}
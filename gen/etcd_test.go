@@ -0,0 +1,105 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix, end []byte
+	}{
+		{[]byte("/dns/"), []byte("/dns0")},
+		{[]byte{'a', 0xff}, []byte{'b'}},
+		{[]byte{0xff, 0xff}, []byte{0}},
+	}
+	for _, tt := range tests {
+		if end := prefixEnd(tt.prefix); !bytes.Equal(end, tt.end) {
+			t.Errorf("prefix %q: expected end %q, got %q", tt.prefix, tt.end, end)
+		}
+	}
+}
+
+func TestEtcd(t *testing.T) {
+	data := map[string]string{
+		"/dns/web":         "10.0.0.1",
+		"/dns/db/primary":  "10.0.0.2",
+		"/dns/api.example": "web.test.lan",
+		"/dns/":            "ignored",
+		"/other/key":       "10.0.0.9",
+	}
+	b64 := base64.StdEncoding.EncodeToString
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["name"] != "kuradns" || req["password"] != "s3cr3t" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "authentication failed, invalid user ID or password"}`))
+				return
+			}
+			w.Write([]byte(`{"token": "tok"}`))
+		case "/v3/kv/range":
+			if r.Header.Get("Authorization") != "tok" {
+				http.Error(w, `{"error": "user name is empty"}`, http.StatusUnauthorized)
+				return
+			}
+			var req struct {
+				Key      string `json:"key"`
+				RangeEnd string `json:"range_end"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			key, _ := base64.StdEncoding.DecodeString(req.Key)
+			end, _ := base64.StdEncoding.DecodeString(req.RangeEnd)
+			var keys []string
+			for k := range data {
+				if k >= string(key) && k < string(end) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			// Return one key at a time to test paging.
+			resp := map[string]interface{}{"more": len(keys) > 1}
+			if len(keys) > 0 {
+				resp["kvs"] = []map[string]string{{"key": b64([]byte(keys[0])), "value": b64([]byte(data[keys[0]]))}}
+			}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	conf := map[string]string{
+		"dns.zone":        "test.lan",
+		"config.url":      ts.URL,
+		"config.prefix":   "/dns/",
+		"config.user":     "kuradns",
+		"config.password": "s3cr3t",
+	}
+	g, err := newEtcd(context.Background(), typeConfig("etcd", conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, g, []RawEntry{
+		{Source: "api.example", Target: "web.test.lan"},
+		{Source: "db.primary", Target: "10.0.0.2"},
+		{Source: "web.test.lan", Target: "10.0.0.1"},
+	})
+
+	conf["config.password"] = "wrong"
+	if _, err := newEtcd(context.Background(), typeConfig("etcd", conf)); err == nil {
+		t.Error("expected authentication error")
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+var execOnce sync.Once
+
+// RegisterExec registers the exec type of generator. Sources of this type run any command
+// with the privileges of the server, so the type is only available if explicitly enabled.
+func RegisterExec() {
+	execOnce.Do(func() {
+		Register("exec", newExecgen, Meta{
+			Description: "Entries printed by a command",
+			Keys: withFormatKeys(
+				Key{Name: "config.command", Required: true},
+				Key{Name: "config.format", Default: "hosts", Values: formatNames},
+				Key{Name: "config.timeout", Type: TypeDuration, Default: "30s"},
+				Key{Name: "config.dir"},
+				Key{Name: "config.env.*", Secret: true},
+			),
+		})
+	})
+}
+
+const (
+	// Maximum number of bytes of the standard error of a command reported in errors
+	execMaxStderr = 1024
+	// Maximum number of bytes read from the standard output and error of a command
+	execMaxOutput = 16 << 20
+	// Time to wait for the output of a command to be closed after it is killed
+	execWaitDelay = time.Second
+)
+
+// execDeniedEnv are the variables that cannot be set in config.env, as they change which
+// programs run or the code they load; execDeniedPrefixes are denied prefixes of variables.
+var (
+	execDeniedEnv      = []string{"PATH", "IFS", "ENV", "BASH_ENV", "SHELLOPTS", "BASHOPTS", "PS4", "GCONV_PATH", "HOSTALIASES"}
+	execDeniedPrefixes = []string{"LD_", "DYLD_", "BASH_FUNC_"}
+)
+
+// newExecgen returns a generator yielding the entries printed on standard output by
+// config.command. The output format is config.format, hosts by default or jsonl for one
+// JSON record per line. The command runs in config.dir for at most config.timeout with
+// only PATH and the variables set in config.env.<NAME> as environment. On timeout, all
+// the processes started by the command are killed.
+func newExecgen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	cmdline, ok := c.Get("config.command")
+	if !ok || cmdline == "" {
+		return nil, errors.New("exec command not specified")
+	}
+	args, err := splitArgs(cmdline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %s", err)
+	}
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	format := c.GetVal("config.format", "")
+	env, err := execEnv(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = c.GetVal("config.dir", "")
+	cmd.Env = env
+	cmd.WaitDelay = execWaitDelay
+	killGroupOnCancel(cmd)
+	stdout := &limitedBuffer{max: execMaxOutput}
+	stderr := &limitedBuffer{max: execMaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			err = fmt.Errorf("timed out after %s", timeout)
+		case context.Canceled:
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("command %s failed: %s%s", args[0], err, stderrSuffix(stderr.Bytes()))
+	}
+	if stdout.over {
+		return nil, fmt.Errorf("output of %s is longer than %d bytes", args[0], execMaxOutput)
+	}
+	if len(stderr.Bytes()) > 0 {
+		log.Printf("[info] exec: %s: %s", args[0], stderrSuffix(stderr.Bytes()))
+	}
+	entries, err := parseFormat(&stdout.buf, format, c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read output of %s: %s", args[0], err)
+	}
+	return newListgen(entries), nil
+}
+
+// execEnv returns the environment of the command: PATH of the server and the variables
+// set as config.env.<NAME>, except those that could alter what is run.
+func execEnv(c *cfg.Config) ([]string, error) {
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	for k, v := range c.Prefixed("config.env.") {
+		if k == "" || strings.ContainsAny(k, "= \t\n") {
+			return nil, fmt.Errorf("invalid environment variable name '%s'", k)
+		}
+		name := strings.ToUpper(k)
+		for _, d := range execDeniedEnv {
+			if name == d {
+				return nil, fmt.Errorf("environment variable %s cannot be set", k)
+			}
+		}
+		for _, p := range execDeniedPrefixes {
+			if strings.HasPrefix(name, p) {
+				return nil, fmt.Errorf("environment variable %s cannot be set", k)
+			}
+		}
+		env = append(env, k+"="+v)
+	}
+	return env, nil
+}
+
+// limitedBuffer is a buffer that discards what is written after the first max bytes.
+type limitedBuffer struct {
+	buf  bytes.Buffer
+	max  int
+	over bool
+}
+
+// Write appends to the buffer as much of p as fits. Writes never fail, so that the
+// command is not interrupted by a broken pipe.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.buf.Len(); len(p) > n {
+		b.over = true
+		b.buf.Write(p[:n])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the content of the buffer.
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// stderrSuffix formats the tail of the standard error output b to be appended to a message.
+func stderrSuffix(b []byte) string {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return ""
+	}
+	if len(b) > execMaxStderr {
+		b = append([]byte("..."), b[len(b)-execMaxStderr:]...)
+	}
+	return fmt.Sprintf(": stderr: %s", b)
+}
+
+// splitArgs splits s into words separated by spaces. Single and double quotes group
+// words; a backslash escapes the next character outside of single quotes.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		cur   strings.Builder
+		quote rune
+		word  bool
+		esc   bool
+	)
+	for _, r := range s {
+		switch {
+		case esc:
+			cur.WriteRune(r)
+			esc = false
+		case r == '\\' && quote != '\'':
+			esc, word = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, word = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if word {
+				args = append(args, cur.String())
+				cur.Reset()
+				word = false
+			}
+		default:
+			cur.WriteRune(r)
+			word = true
+		}
+	}
+	if quote != 0 || esc {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if word {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
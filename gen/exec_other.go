@@ -0,0 +1,13 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package gen
+
+import "os/exec"
+
+// killGroupOnCancel does nothing: only the command itself is killed when the context
+// of cmd is done, the output is abandoned after execWaitDelay.
+func killGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,93 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for s, expected := range map[string][]string{
+		`inventory --zone lan`: {"inventory", "--zone", "lan"},
+		`sh -c 'echo "a b"'`:   {"sh", "-c", `echo "a b"`},
+		`print\ hosts "" x`:    {"print hosts", "", "x"},
+		"  a\t\"b c\"d  ":      {"a", "b cd"},
+		`echo "say \"hi\""`:    {"echo", `say "hi"`},
+		`one 'two \'`:          {"one", `two \`},
+	} {
+		args, err := splitArgs(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("%s: expected %q, got %q", s, expected, args)
+		}
+	}
+	for _, s := range []string{``, `  `, `a 'b`, `a\`} {
+		if _, err := splitArgs(s); err == nil {
+			t.Errorf("expected error splitting %q", s)
+		}
+	}
+}
+
+func TestExecgen(t *testing.T) {
+	conf := cfg.FromMap(map[string]string{
+		"dns.zone":        "lan",
+		"config.command":  `sh -c 'echo "{\"name\": \"$NAME\", \"target\": \"10.0.0.1\"}"'`,
+		"config.format":   "jsonl",
+		"config.env.NAME": "build",
+		"config.timeout":  "5s",
+	})
+	g, err := newExecgen(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := g.Generate(context.Background()); e == nil || e.Source != "build.lan" || e.Target != "10.0.0.1" {
+		t.Errorf("unexpected entry %v", e)
+	}
+
+	conf.Put("config.command", `sh -c 'echo broken inventory >&2; exit 3'`)
+	_, err = newExecgen(context.Background(), conf)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "broken inventory") {
+		t.Errorf("expected error with exit status and stderr, got %v", err)
+	}
+
+	// The shell waits for sleep, which holds the output open: both must be killed.
+	conf.Put("config.command", `sh -c 'sleep 5; echo late'`)
+	conf.Put("config.timeout", "50ms")
+	start := time.Now()
+	if _, err = newExecgen(context.Background(), conf); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("command not stopped after timeout, returned after %s", d)
+	}
+
+	conf.Put("config.command", fmt.Sprintf("head -c %d /dev/zero", execMaxOutput+1))
+	conf.Put("config.timeout", "5s")
+	if _, err = newExecgen(context.Background(), conf); err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Errorf("expected error for long output, got %v", err)
+	}
+}
+
+func TestExecgenEnv(t *testing.T) {
+	for _, name := range []string{"PATH", "path", "LD_PRELOAD", "ld_library_path", "DYLD_INSERT_LIBRARIES", "BASH_ENV", "A=B"} {
+		_, err := newExecgen(context.Background(), cfg.FromMap(map[string]string{
+			"config.command":     "true",
+			"config.env." + name: "/tmp",
+		}))
+		if err == nil {
+			t.Errorf("expected error setting %s", name)
+		}
+	}
+}
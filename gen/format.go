@@ -0,0 +1,85 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+	"github.com/dullgiulio/kuradns/hosts"
+)
+
+// formatNames lists the formats known to parseFormat.
+var formatNames = []string{"hosts", "csv", "json", "yaml", "jsonl", "zone"}
+
+// withFormatKeys returns keys followed by the options of parseFormat for the csv and zone formats.
+func withFormatKeys(keys ...Key) []Key {
+	keys = append(keys, csvKeys...)
+	return append(keys, Key{Name: "config.origin"})
+}
+
+// parseFormat reads entries from r. format is one of "hosts", "csv", "json", "jsonl"
+// (one JSON record per line), "yaml" or "zone". Options for the format are read from c.
+func parseFormat(r io.Reader, format string, c *cfg.Config) ([]*RawEntry, error) {
+	zone := c.GetVal("dns.zone", "lan")
+	switch format {
+	case "hosts":
+		h, err := hosts.Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		return hostsEntries(h, zone), nil
+	case "csv":
+		o, err := newCsvOptions(c)
+		if err != nil {
+			return nil, err
+		}
+		return parseCsv(r, o, zone)
+	case "json", "yaml":
+		return parseRecords(r, format, zone)
+	case "jsonl":
+		return parseRecordLines(r, zone)
+	case "zone":
+		return parseZone(r, c.GetVal("config.origin", zone), "")
+	}
+	return nil, fmt.Errorf("unknown format '%s'", format)
+}
+
+// fileFormat returns the format of the file at path based on its extension,
+// or def if the extension is not known.
+func fileFormat(path, def string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hosts":
+		return "hosts"
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".yml", ".yaml":
+		return "yaml"
+	case ".zone":
+		return "zone"
+	}
+	return def
+}
+
+// parseFile reads entries in format from the file at path. kind describes
+// the file in error messages.
+func parseFile(path, format, kind string, c *cfg.Config) ([]*RawEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %s", kind, err)
+	}
+	defer f.Close()
+	entries, err := parseFormat(f, format, c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s %s: %s", kind, path, err)
+	}
+	return entries, nil
+}
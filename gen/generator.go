@@ -5,6 +5,7 @@
 package gen
 
 import (
+	"context"
 	"errors"
 
 	"github.com/dullgiulio/kuradns/cfg"
@@ -12,22 +13,31 @@ import (
 
 type Generator interface {
 	// generate reuturns an entry between a hostname its destination IP/hostname.
-	// When no more pairs are available, generate should return an empty rawentry
-	Generate() (*RawEntry, error)
+	// When no more pairs are available, generate should return an empty rawentry.
+	// If ctx is done before the next entry is available, its error is returned.
+	Generate(ctx context.Context) (*RawEntry, error)
+	// Close releases the resources of the generator. Entries not yet generated are discarded.
+	Close() error
 }
 
 var ErrInvalidGenerator = errors.New("invalid generator name")
 
-func MakeGenerator(name string, conf *cfg.Config) (Generator, error) {
-	switch name { // strings.Lower
-	case "mysql":
-		return newMysql(conf)
-	case "date":
-		g := newDategen(conf)
-		return g, nil
-	case "static":
-		return newStaticgen(conf)
-	default:
+// ErrNotModified is returned when creating a generator whose data has not
+// changed since the last time it was generated.
+var ErrNotModified = errors.New("source not modified")
+
+// MakeGenerator returns a new generator of the registered type name configured by conf,
+// where keys that are not set take the defaults in the Meta of the type. Work done to prepare the generator is aborted when ctx is done.
+func MakeGenerator(ctx context.Context, name string, conf *cfg.Config) (Generator, error) {
+	registryMux.RLock()
+	r, ok := registry[name]
+	registryMux.RUnlock()
+	if !ok {
 		return nil, ErrInvalidGenerator
 	}
+	g, err := r.factory(ctx, conf.WithDefaults(r.defaults))
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
 }
@@ -0,0 +1,62 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+	"github.com/dullgiulio/kuradns/hosts"
+)
+
+func init() {
+	Register("hostsfile", newHostsfile, Meta{
+		Description: "Entries in a hosts file",
+		Keys: []Key{
+			{Name: "config.path", Required: true},
+			{Name: "config.watch", Type: TypeDuration},
+		},
+	})
+}
+
+// newHostsfile returns a generator yielding one entry for each hostname
+// found in the hosts file at config.path. The file is watched for changes
+// if config.watch is set to a polling interval.
+func newHostsfile(ctx context.Context, c *cfg.Config) (Generator, error) {
+	path, ok := c.Get("config.path")
+	if !ok || path == "" {
+		return nil, errors.New("hosts file path not specified")
+	}
+	return newFilegen(ctx, c, path, "hosts", "hosts file")
+}
+
+// hostsEntries converts h into a list of entries sorted by hostname, one for each
+// address of a hostname. Hostnames without any dot are considered to be inside zone.
+func hostsEntries(h hosts.Hosts, zone string) []*RawEntry {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]*RawEntry, 0, len(names))
+	for _, name := range names {
+		for _, addr := range h[name] {
+			entries = append(entries, NewRawEntry(qualify(name, zone), addr))
+		}
+	}
+	return entries
+}
+
+// qualify appends zone to name if name is a single label.
+func qualify(name, zone string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", name, zone)
+}
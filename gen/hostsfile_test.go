@@ -0,0 +1,42 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestHostsfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kuradns-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts")
+	data := "10.0.0.1 web\n10.0.0.2 db db.example.com\nfe80::1 web\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := newHostsfile(context.Background(), cfg.FromMap(map[string]string{
+		"dns.zone":    "test.lan",
+		"config.path": path,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	checkEntries(t, g, []RawEntry{
+		{Source: "db.test.lan", Target: "10.0.0.2"},
+		{Source: "db.example.com", Target: "10.0.0.2"},
+		{Source: "web.test.lan", Target: "10.0.0.1"},
+		{Source: "web.test.lan", Target: "fe80::1"},
+	})
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("http", newHttpgen, Meta{
+		Description: "Entries in a document fetched over HTTP",
+		Keys: withFormatKeys(
+			Key{Name: "config.url", Required: true},
+			Key{Name: "config.format", Default: "hosts", Values: formatNames},
+			Key{Name: "config.timeout", Type: TypeDuration, Default: "30s"},
+			Key{Name: "config.header.*", Secret: true},
+		),
+	})
+}
+
+// Cache keys for the validators of the last successful HTTP fetch.
+const (
+	httpCacheETag         = cfg.CachePrefix + "http.etag"
+	httpCacheLastModified = cfg.CachePrefix + "http.last-modified"
+)
+
+// newHttpgen returns a generator yielding entries from the document at config.url.
+// The document format is given by config.format (hosts, json, yaml or csv).
+// Headers in config.header.<Name> are added to the request.
+//
+// If the document has not changed since the last fetch, ErrNotModified is returned.
+func newHttpgen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	url, ok := c.Get("config.url")
+	if !ok || url == "" {
+		return nil, errors.New("http url not specified")
+	}
+	format := c.GetVal("config.format", "")
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http request: %s", err)
+	}
+	for k, v := range c.Prefixed("config.header.") {
+		req.Header.Set(k, v)
+	}
+	if etag, ok := c.Get(httpCacheETag); ok {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lm, ok := c.Get(httpCacheLastModified); ok {
+		req.Header.Set("If-Modified-Since", lm)
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch %s: %s", url, resp.Status)
+	}
+	entries, err := parseFormat(resp.Body, format, c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", url, err)
+	}
+	// Validators are only stored once the document was read successfully.
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.Put(httpCacheETag, etag)
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		c.Put(httpCacheLastModified, lm)
+	}
+	return newListgen(entries), nil
+}
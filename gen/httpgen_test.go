@@ -0,0 +1,72 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpgenNotModified(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, "10.0.0.1 one\n10.0.0.2 two.test.lan\n")
+	}))
+	defer ts.Close()
+
+	conf := typeConfig("http", map[string]string{
+		"dns.zone":              "test.lan",
+		"config.url":            ts.URL,
+		"config.header.X-Token": "secret",
+	})
+	g, err := newHttpgen(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one.test.lan", "two.test.lan"} {
+		e, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil || e.Source != name {
+			t.Fatalf("expected entry for %s, got %v", name, e)
+		}
+	}
+	if _, err := newHttpgen(context.Background(), conf); err != ErrNotModified {
+		t.Errorf("expected ErrNotModified on second fetch, got %v", err)
+	}
+	if _, ok := conf.Persistent()[httpCacheETag]; ok {
+		t.Errorf("cached ETag must not be persisted")
+	}
+}
+
+func TestHttpgenCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := newHttpgen(ctx, typeConfig("http", map[string]string{"config.url": ts.URL})); err == nil {
+		t.Fatal("expected error for cancelled fetch")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("fetch not aborted, took %s", d)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kubeconfig holds the connection settings of a context in a kubeconfig file.
+type kubeconfig struct {
+	server   string
+	token    string
+	username string
+	password string
+	tls      *tls.Config
+}
+
+// kubeconfigFile is the part of a kubeconfig file read by loadKubeconfig.
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string
+		Context struct {
+			Cluster string
+			User    string
+		}
+	}
+	Clusters []struct {
+		Name    string
+		Cluster kubeCluster
+	}
+	Users []struct {
+		Name string
+		User kubeUser
+	}
+}
+
+// kubeCluster is a cluster entry of a kubeconfig file.
+type kubeCluster struct {
+	Server                   string
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+}
+
+// kubeUser is a user entry of a kubeconfig file.
+type kubeUser struct {
+	Token                 string
+	TokenFile             string `yaml:"tokenFile"`
+	Username              string
+	Password              string
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+}
+
+// loadKubeconfig reads the settings of context (or of the current context if empty)
+// from the kubeconfig file at path. Relative file names are relative to the directory
+// of the kubeconfig file.
+func loadKubeconfig(path, context string) (*kubeconfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open kubeconfig: %s", err)
+	}
+	var f kubeconfigFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("cannot read kubeconfig %s: %s", path, err)
+	}
+	kc, err := parseKubeconfig(&f, context, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %s", path, err)
+	}
+	return kc, nil
+}
+
+// parseKubeconfig extracts the settings of context from a parsed kubeconfig file.
+func parseKubeconfig(f *kubeconfigFile, context, dir string) (*kubeconfig, error) {
+	if context == "" {
+		context = f.CurrentContext
+	}
+	if context == "" {
+		return nil, errors.New("no context specified and no current context")
+	}
+	var clusterName, userName string
+	found := false
+	for _, c := range f.Contexts {
+		if c.Name == context {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context '%s' not found", context)
+	}
+	var cluster *kubeCluster
+	for i := range f.Clusters {
+		if f.Clusters[i].Name == clusterName {
+			cluster = &f.Clusters[i].Cluster
+			break
+		}
+	}
+	if cluster == nil {
+		return nil, fmt.Errorf("cluster '%s' not found", clusterName)
+	}
+	kc := &kubeconfig{
+		server: cluster.Server,
+		tls:    &tls.Config{InsecureSkipVerify: cluster.InsecureSkipTLSVerify},
+	}
+	if kc.server == "" {
+		return nil, errors.New("cluster server not specified")
+	}
+	ca, err := kubeData("certificate-authority", cluster.CertificateAuthorityData, cluster.CertificateAuthority, dir)
+	if err != nil {
+		return nil, err
+	}
+	if ca != nil {
+		kc.tls.RootCAs = x509.NewCertPool()
+		if !kc.tls.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no valid certificates in certificate authority")
+		}
+	}
+	// The user can be omitted for clusters that do not require authentication.
+	var user *kubeUser
+	for i := range f.Users {
+		if f.Users[i].Name == userName {
+			user = &f.Users[i].User
+			break
+		}
+	}
+	if user == nil {
+		return kc, nil
+	}
+	kc.token = user.Token
+	if kc.token == "" && user.TokenFile != "" {
+		b, err := ioutil.ReadFile(kubePath(user.TokenFile, dir))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read token file: %s", err)
+		}
+		kc.token = strings.TrimSpace(string(b))
+	}
+	kc.username = user.Username
+	kc.password = user.Password
+	cert, err := kubeData("client-certificate", user.ClientCertificateData, user.ClientCertificate, dir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := kubeData("client-key", user.ClientKeyData, user.ClientKey, dir)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil || key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %s", err)
+		}
+		kc.tls.Certificates = []tls.Certificate{pair}
+	}
+	return kc, nil
+}
+
+// kubeData returns the base64 encoded data or else the content of file, the settings
+// key-data and key. It returns nil if neither is set.
+func kubeData(key, data, file, dir string) ([]byte, error) {
+	if data != "" {
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s-data: %s", key, err)
+		}
+		return b, nil
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(kubePath(file, dir))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", key, err)
+		}
+		return b, nil
+	}
+	return nil, nil
+}
+
+// kubePath returns file relative to dir unless it is absolute.
+func kubePath(file, dir string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(dir, file)
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("kubernetes", newKubernetes, Meta{
+		Description: "Kubernetes Services and Ingress hosts",
+		Keys: []Key{
+			{Name: "config.kubeconfig"},
+			{Name: "config.context"},
+			{Name: "config.url"},
+			{Name: "config.token", Secret: true},
+			{Name: "config.insecure", Type: TypeBool, Default: "false"},
+			{Name: "config.namespace"},
+			{Name: "config.clusterip", Type: TypeBool, Default: "true"},
+			{Name: "config.ingress", Type: TypeBool, Default: "true"},
+			{Name: "config.timeout", Type: TypeDuration, Default: "30s"},
+		},
+	})
+}
+
+// Maximum number of objects requested in a single list call.
+const kubeListLimit = 500
+
+// kubeLoadBalancer is the load balancer status of a Service or Ingress.
+type kubeLoadBalancer struct {
+	Ingress []struct {
+		IP       string `json:"ip"`
+		Hostname string `json:"hostname"`
+	} `json:"ingress"`
+}
+
+// kubeObject is the part of a Service or Ingress object used here.
+type kubeObject struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Type      string `json:"type"`
+		ClusterIP string `json:"clusterIP"`
+		Rules     []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+	} `json:"spec"`
+	Status struct {
+		LoadBalancer kubeLoadBalancer `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+// kubeList is a page of a list of objects.
+type kubeList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []kubeObject `json:"items"`
+}
+
+// kubeClient lists objects from the Kubernetes API.
+type kubeClient struct {
+	ctx    context.Context
+	conf   *kubeconfig
+	client *http.Client
+}
+
+// newKubernetes returns a generator yielding entries for the Services and Ingresses
+// of a Kubernetes cluster. The cluster is either taken from context config.context of the
+// kubeconfig file at config.kubeconfig, or given as config.url with a bearer config.token.
+// Services resolve as <service>.<namespace>.<zone> to their load balancer addresses, or
+// to their cluster IP unless config.clusterip is false. Ingress hosts resolve to the
+// addresses of their load balancer unless config.ingress is false. Only namespace
+// config.namespace is listed if set.
+func newKubernetes(ctx context.Context, c *cfg.Config) (Generator, error) {
+	kc, err := kubeSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	clusterIP, err := c.GetBool("config.clusterip", false)
+	if err != nil {
+		return nil, err
+	}
+	ingress, err := c.GetBool("config.ingress", false)
+	if err != nil {
+		return nil, err
+	}
+	zone := c.GetVal("dns.zone", "lan")
+	kube := &kubeClient{
+		ctx:  ctx,
+		conf: kc,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: kc.tls},
+		},
+	}
+	namespace := c.GetVal("config.namespace", "")
+	services, err := kube.list("/api/v1", namespace, "services")
+	if err != nil {
+		return nil, err
+	}
+	var entries []*RawEntry
+	for i := range services {
+		entries = append(entries, serviceEntries(&services[i], clusterIP, zone)...)
+	}
+	if ingress {
+		ingresses, err := kube.list("/apis/networking.k8s.io/v1", namespace, "ingresses")
+		if err != nil {
+			return nil, err
+		}
+		for i := range ingresses {
+			entries = append(entries, ingressEntries(&ingresses[i], zone)...)
+		}
+	}
+	return newListgen(entries), nil
+}
+
+// kubeSettings returns the cluster connection settings from the kubeconfig file or
+// the URL and token in c.
+func kubeSettings(c *cfg.Config) (*kubeconfig, error) {
+	if path, ok := c.Get("config.kubeconfig"); ok && path != "" {
+		return loadKubeconfig(path, c.GetVal("config.context", ""))
+	}
+	server, ok := c.Get("config.url")
+	if !ok || server == "" {
+		return nil, errors.New("kubernetes kubeconfig or url not specified")
+	}
+	insecure, err := c.GetBool("config.insecure", false)
+	if err != nil {
+		return nil, err
+	}
+	return &kubeconfig{
+		server: server,
+		token:  c.GetVal("config.token", ""),
+		tls:    &tls.Config{InsecureSkipVerify: insecure},
+	}, nil
+}
+
+// list returns all objects of resource in API group path, in namespace or in all
+// namespaces if namespace is empty.
+func (k *kubeClient) list(group, namespace, resource string) ([]kubeObject, error) {
+	path := group + "/" + resource
+	if namespace != "" {
+		path = group + "/namespaces/" + url.PathEscape(namespace) + "/" + resource
+	}
+	var objs []kubeObject
+	cont := ""
+	for {
+		q := url.Values{"limit": {fmt.Sprintf("%d", kubeListLimit)}}
+		if cont != "" {
+			q.Set("continue", cont)
+		}
+		var page kubeList
+		if err := k.get(path+"?"+q.Encode(), &page); err != nil {
+			return nil, fmt.Errorf("cannot list %s: %s", resource, err)
+		}
+		objs = append(objs, page.Items...)
+		cont = page.Metadata.Continue
+		if cont == "" {
+			return objs, nil
+		}
+	}
+}
+
+// get decodes the JSON document at path into v.
+func (k *kubeClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(k.conf.server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if k.conf.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.conf.token)
+	} else if k.conf.username != "" {
+		req.SetBasicAuth(k.conf.username, k.conf.password)
+	}
+	resp, err := k.client.Do(req.WithContext(k.ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// serviceEntries returns the entries for Service svc.
+func serviceEntries(svc *kubeObject, clusterIP bool, zone string) []*RawEntry {
+	name := fmt.Sprintf("%s.%s.%s", svc.Metadata.Name, svc.Metadata.Namespace, zone)
+	entries := lbEntries(name, &svc.Status.LoadBalancer)
+	if len(entries) > 0 || !clusterIP {
+		return entries
+	}
+	// Headless services have no cluster IP.
+	if ip := svc.Spec.ClusterIP; ip != "" && ip != "None" {
+		entries = append(entries, NewRawEntry(name, ip))
+	}
+	return entries
+}
+
+// ingressEntries returns the entries for the hosts of Ingress ing.
+func ingressEntries(ing *kubeObject, zone string) []*RawEntry {
+	var entries []*RawEntry
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == "" {
+			continue
+		}
+		entries = append(entries, lbEntries(qualify(rule.Host, zone), &ing.Status.LoadBalancer)...)
+	}
+	return entries
+}
+
+// lbEntries returns entries from name to the addresses or hostnames of lb.
+func lbEntries(name string, lb *kubeLoadBalancer) []*RawEntry {
+	var entries []*RawEntry
+	for _, in := range lb.Ingress {
+		target := in.IP
+		if target == "" {
+			target = in.Hostname
+		}
+		if target != "" {
+			entries = append(entries, NewRawEntry(name, target))
+		}
+	}
+	return entries
+}
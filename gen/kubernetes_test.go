@@ -0,0 +1,145 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func fakeKubernetes(t *testing.T) *httptest.Server {
+	pages := map[string]string{
+		"/api/v1/services?limit=500": `{"metadata": {"continue": "p2"}, "items": [
+			{"metadata": {"name": "web", "namespace": "default"}, "spec": {"type": "ClusterIP", "clusterIP": "10.96.0.10"}},
+			{"metadata": {"name": "db", "namespace": "prod"}, "spec": {"type": "ClusterIP", "clusterIP": "None"}}]}`,
+		"/api/v1/services?continue=p2&limit=500": `{"metadata": {}, "items": [
+			{"metadata": {"name": "gw", "namespace": "prod"}, "spec": {"type": "LoadBalancer", "clusterIP": "10.96.0.20"},
+			 "status": {"loadBalancer": {"ingress": [{"ip": "192.168.1.20"}]}}}]}`,
+		"/apis/networking.k8s.io/v1/ingresses?limit=500": `{"metadata": {}, "items": [
+			{"metadata": {"name": "site", "namespace": "prod"}, "spec": {"rules": [{"host": "www.example.com"}, {"host": "shop"}]},
+			 "status": {"loadBalancer": {"ingress": [{"hostname": "lb.example.com"}]}}}]}`,
+	}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		page, ok := pages[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+}
+
+var kubernetesEntries = []RawEntry{
+	{Source: "web.default.test.lan", Target: "10.96.0.10"},
+	{Source: "gw.prod.test.lan", Target: "192.168.1.20"},
+	{Source: "www.example.com", Target: "lb.example.com"},
+	{Source: "shop.test.lan", Target: "lb.example.com"},
+}
+
+func checkKubernetes(t *testing.T, conf *cfg.Config) {
+	g, err := newKubernetes(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range kubernetesEntries {
+		e, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil || *e != exp {
+			t.Fatalf("expected %v, got %v", exp, e)
+		}
+	}
+	if e, _ := g.Generate(context.Background()); e != nil {
+		t.Errorf("unexpected entry %v", e)
+	}
+}
+
+func TestKubernetesToken(t *testing.T) {
+	ts := fakeKubernetes(t)
+	defer ts.Close()
+
+	checkKubernetes(t, typeConfig("kubernetes", map[string]string{
+		"dns.zone":        "test.lan",
+		"config.url":      ts.URL,
+		"config.token":    "s3cr3t",
+		"config.insecure": "true",
+	}))
+	_, err := newKubernetes(context.Background(), typeConfig("kubernetes", map[string]string{
+		"config.url":      ts.URL,
+		"config.token":    "wrong",
+		"config.insecure": "true",
+	}))
+	if err == nil {
+		t.Error("expected error for invalid token")
+	}
+}
+
+func TestKubernetesKubeconfig(t *testing.T) {
+	ts := fakeKubernetes(t)
+	defer ts.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	dir, err := ioutil.TempDir("", "kuradns-kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "token"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: other
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: other
+  context:
+    cluster: missing
+- name: test
+  context:
+    cluster: test
+    user: admin
+    namespace: default
+users:
+- name: admin
+  user:
+    tokenFile: token
+`, ts.URL, base64.StdEncoding.EncodeToString(ca))
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	checkKubernetes(t, typeConfig("kubernetes", map[string]string{
+		"dns.zone":          "test.lan",
+		"config.kubeconfig": path,
+		"config.context":    "test",
+	}))
+	_, err = newKubernetes(context.Background(), typeConfig("kubernetes", map[string]string{
+		"config.kubeconfig": path,
+	}))
+	if err == nil {
+		t.Error("expected error for context with missing cluster")
+	}
+}
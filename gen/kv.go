@@ -0,0 +1,34 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"sort"
+	"strings"
+)
+
+// kvEntries returns the entries for the keys with prefix in kvs, sorted by key. The name of an
+// entry is the rest of its key, with slashes turned into dots, qualified with zone if it has no dots.
+// The target is the value. Keys with nothing after the prefix and empty values are skipped.
+func kvEntries(kvs map[string]string, prefix, zone string) []*RawEntry {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var entries []*RawEntry
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		name := strings.Trim(strings.Replace(k[len(prefix):], "/", ".", -1), ".")
+		target := strings.TrimSpace(kvs[k])
+		if name == "" || target == "" {
+			continue
+		}
+		entries = append(entries, NewRawEntry(qualify(name, zone), target))
+	}
+	return entries
+}
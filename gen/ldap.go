@@ -0,0 +1,217 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/ldap.v2"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("ldap", newLdap, Meta{
+		Description: "Objects found by an LDAP search",
+		Keys: []Key{
+			{Name: "config.url", Required: true},
+			{Name: "config.base", Required: true},
+			{Name: "config.scope", Default: "sub", Values: []string{"base", "one", "sub"}},
+			{Name: "config.filter", Default: "(objectClass=*)"},
+			{Name: "config.attr.name", Default: "cn"},
+			{Name: "config.attr.address", Default: "ipHostNumber"},
+			{Name: "config.bind.dn"},
+			{Name: "config.bind.password", Secret: true},
+			{Name: "config.starttls", Type: TypeBool, Default: "false"},
+			{Name: "config.ca"},
+			{Name: "config.insecure", Type: TypeBool, Default: "false"},
+			{Name: "config.pagesize", Type: TypeInt, Default: "500"},
+			{Name: "config.timeout", Type: TypeDuration, Default: "30s"},
+		},
+	})
+}
+
+// Search scopes by configuration name.
+var ldapScopes = map[string]int{
+	"base": ldap.ScopeBaseObject,
+	"one":  ldap.ScopeSingleLevel,
+	"sub":  ldap.ScopeWholeSubtree,
+}
+
+// newLdap returns a generator yielding entries from the objects found by an LDAP search
+// on the server at config.url (ldap:// or ldaps://). The search starts at config.base with
+// scope config.scope (base, one or sub, default sub) and filter config.filter. Each value
+// of attribute config.attr.name (default cn) resolves to each value of attribute
+// config.attr.address (default ipHostNumber).
+//
+// If config.bind.dn is set, a simple bind is done with config.bind.password. config.starttls
+// upgrades plain connections to TLS, verified against the certificates in config.ca if set.
+// Results are requested in pages of config.pagesize entries (default 500, 0 disables paging).
+func newLdap(ctx context.Context, c *cfg.Config) (Generator, error) {
+	rawurl, ok := c.Get("config.url")
+	if !ok || rawurl == "" {
+		return nil, errors.New("ldap url not specified")
+	}
+	base, ok := c.Get("config.base")
+	if !ok {
+		return nil, errors.New("ldap search base not specified")
+	}
+	scope, ok := ldapScopes[c.GetVal("config.scope", "")]
+	if !ok {
+		return nil, fmt.Errorf("invalid ldap scope '%s'", c.GetVal("config.scope", ""))
+	}
+	filter := c.GetVal("config.filter", "")
+	if _, err := ldap.CompileFilter(filter); err != nil {
+		return nil, fmt.Errorf("invalid ldap filter: %s", err)
+	}
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	pageSize, err := c.GetInt("config.pagesize", 0)
+	if err != nil {
+		return nil, err
+	}
+	starttls, err := c.GetBool("config.starttls", false)
+	if err != nil {
+		return nil, err
+	}
+	nameAttr := c.GetVal("config.attr.name", "")
+	addrAttr := c.GetVal("config.attr.address", "")
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap url: %s", err)
+	}
+	if starttls && u.Scheme == "ldaps" {
+		return nil, errors.New("ldap starttls cannot be used with ldaps")
+	}
+	tlsConf, err := ldapTLSConfig(c, u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialLdap(ctx, u, tlsConf, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer closeOnDone(ctx, conn)()
+	l := ldap.NewConn(conn, u.Scheme == "ldaps")
+	l.SetTimeout(timeout)
+	l.Start()
+	defer l.Close()
+	if starttls {
+		if err := l.StartTLS(tlsConf); err != nil {
+			return nil, fmt.Errorf("ldap starttls failed: %s", err)
+		}
+	}
+	if dn, ok := c.Get("config.bind.dn"); ok && dn != "" {
+		password, ok := c.Get("config.bind.password")
+		if !ok || password == "" {
+			return nil, errors.New("ldap bind password not specified")
+		}
+		if err := l.Bind(dn, password); err != nil {
+			return nil, fmt.Errorf("ldap bind failed: %s", err)
+		}
+	}
+	req := ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{nameAttr, addrAttr}, nil)
+	var res *ldap.SearchResult
+	if pageSize > 0 {
+		res, err = l.SearchWithPaging(req, uint32(pageSize))
+	} else {
+		res, err = l.Search(req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap search failed: %s", err)
+	}
+	return newListgen(ldapEntries(res.Entries, nameAttr, addrAttr, c.GetVal("dns.zone", "lan"))), nil
+}
+
+// ldapEntries returns an entry for each value of attribute name resolving to each
+// value of attribute addr of the objects in results. Attribute names are case-insensitive.
+func ldapEntries(results []*ldap.Entry, name, addr, zone string) []*RawEntry {
+	var entries []*RawEntry
+	for _, r := range results {
+		names, addrs := ldapValues(r, name), ldapValues(r, addr)
+		for _, n := range names {
+			for _, a := range addrs {
+				entries = append(entries, NewRawEntry(qualify(n, zone), a))
+			}
+		}
+	}
+	return entries
+}
+
+// ldapValues returns the values of attribute name of e.
+func ldapValues(e *ldap.Entry, name string) []string {
+	var vals []string
+	for _, a := range e.Attributes {
+		if strings.EqualFold(a.Name, name) {
+			vals = append(vals, a.Values...)
+		}
+	}
+	return vals
+}
+
+// ldapTLSConfig returns the TLS configuration to connect to host.
+func ldapTLSConfig(c *cfg.Config, host string) (*tls.Config, error) {
+	insecure, err := c.GetBool("config.insecure", false)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{ServerName: host, InsecureSkipVerify: insecure}
+	if path, ok := c.Get("config.ca"); ok && path != "" {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ldap ca: %s", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates in %s", path)
+		}
+	}
+	return conf, nil
+}
+
+// dialLdap connects to the server at u, using TLS for ldaps.
+func dialLdap(ctx context.Context, u *url.URL, tlsConf *tls.Config, timeout time.Duration) (net.Conn, error) {
+	port := u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ldap url scheme '%s'", u.Scheme)
+	}
+	conn, err := dialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to ldap server: %s", err)
+	}
+	if u.Scheme == "ldaps" {
+		conn.SetDeadline(time.Now().Add(timeout))
+		tc := tls.Client(conn, tlsConf)
+		if err := tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("cannot connect to ldap server: %s", err)
+		}
+		conn.SetDeadline(time.Time{})
+		conn = tc
+	}
+	return conn, nil
+}
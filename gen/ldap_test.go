@@ -0,0 +1,241 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	ber "gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v2"
+)
+
+func TestLdapConfig(t *testing.T) {
+	base := map[string]string{
+		"config.url":  "ldap://127.0.0.1:1",
+		"config.base": "dc=example,dc=com",
+	}
+	for k, v := range map[string]string{
+		"config.scope":    "children",
+		"config.filter":   "(cn=a",
+		"config.url":      "http://127.0.0.1:1",
+		"config.starttls": "true",
+	} {
+		m := map[string]string{k: v}
+		for bk, bv := range base {
+			if _, ok := m[bk]; !ok {
+				m[bk] = bv
+			}
+		}
+		if k == "config.starttls" {
+			m["config.url"] = "ldaps://127.0.0.1:1"
+		}
+		if _, err := newLdap(context.Background(), typeConfig("ldap", m)); err == nil {
+			t.Errorf("%s: expected error for '%s'", k, v)
+		}
+	}
+}
+
+// ldapStub is a minimal LDAP server for tests.
+type ldapStub struct {
+	l        net.Listener
+	tls      *tls.Config
+	dn       string
+	password string
+	filter   string
+	entries  []*ber.Packet
+}
+
+func (s *ldapStub) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func ldapStubResult(op ber.Tag, code int64, msg string) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, ""))
+	return res
+}
+
+func (s *ldapStub) serveConn(conn net.Conn) {
+	defer func() { conn.Close() }()
+	var secure, bound bool
+	reply := func(id interface{}, op *ber.Packet, controls ...ldap.Control) {
+		msg := ber.NewSequence("")
+		msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+		msg.AppendChild(op)
+		if len(controls) > 0 {
+			ctrls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "")
+			for _, c := range controls {
+				ctrls.AppendChild(c.Encode())
+			}
+			msg.AppendChild(ctrls)
+		}
+		conn.Write(msg.Bytes())
+	}
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id, op := msg.Children[0].Value, msg.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationExtendedRequest:
+			reply(id, ldapStubResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, ""))
+			tc := tls.Server(conn, s.tls)
+			if tc.Handshake() != nil {
+				return
+			}
+			conn, secure = tc, true
+		case ldap.ApplicationBindRequest:
+			switch {
+			case !secure:
+				reply(id, ldapStubResult(ldap.ApplicationBindResponse, ldap.LDAPResultConfidentialityRequired, "confidentiality required"))
+			case op.Children[1].Value != s.dn || op.Children[2].Data.String() != s.password:
+				reply(id, ldapStubResult(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "invalid credentials"))
+			default:
+				bound = true
+				reply(id, ldapStubResult(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, ""))
+			}
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				reply(id, ldapStubResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInappropriateAuthentication, "anonymous search not allowed"))
+				continue
+			}
+			if filter, err := ldap.DecompileFilter(op.Children[6]); err != nil || filter != s.filter {
+				reply(id, ldapStubResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultOperationsError, "unexpected filter"))
+				continue
+			}
+			paging, ok := ldap.DecodeControl(msg.Children[2].Children[0]).(*ldap.ControlPaging)
+			if !ok || paging.PagingSize == 0 {
+				reply(id, ldapStubResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+				continue
+			}
+			offset, _ := strconv.Atoi(string(paging.Cookie))
+			end := offset + int(paging.PagingSize)
+			if end > len(s.entries) {
+				end = len(s.entries)
+			}
+			for _, e := range s.entries[offset:end] {
+				reply(id, e)
+			}
+			next := ldap.NewControlPaging(0)
+			if end < len(s.entries) {
+				next.SetCookie([]byte(strconv.Itoa(end)))
+			}
+			reply(id, ldapStubResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""), next)
+		}
+	}
+}
+
+func ldapStubEntry(dn string, attrs map[string][]string) *ber.Packet {
+	e := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	e.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+	list := ber.NewSequence("")
+	for name, vals := range attrs {
+		attr := ber.NewSequence("")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	e.AppendChild(list)
+	return e
+}
+
+func TestLdap(t *testing.T) {
+	// Borrow the certificate of a test HTTPS server.
+	ts := httptest.NewTLSServer(nil)
+	cert := ts.TLS.Certificates[0]
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	ts.Close()
+
+	dir, err := ioutil.TempDir("", "kuradns-ldap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caPath := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caPath, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	stub := &ldapStub{
+		l:        l,
+		tls:      &tls.Config{Certificates: []tls.Certificate{cert}},
+		dn:       "cn=kuradns,dc=example,dc=com",
+		password: "s3cr3t",
+		filter:   "(objectClass=device)",
+		entries: []*ber.Packet{
+			ldapStubEntry("cn=ws1,ou=hosts,dc=example,dc=com", map[string][]string{
+				"cn": {"ws1", "ws1-alias"}, "ipHostNumber": {"10.0.0.1"},
+			}),
+			ldapStubEntry("cn=ws2,ou=hosts,dc=example,dc=com", map[string][]string{
+				"CN": {"ws2.example.com"}, "iphostnumber": {"10.0.0.2", "10.0.0.3"},
+			}),
+			ldapStubEntry("cn=ws3,ou=hosts,dc=example,dc=com", map[string][]string{
+				"cn": {"ws3"},
+			}),
+		},
+	}
+	go stub.serve()
+
+	conf := map[string]string{
+		"dns.zone":             "test.lan",
+		"config.url":           "ldap://" + l.Addr().String(),
+		"config.starttls":      "true",
+		"config.ca":            caPath,
+		"config.bind.dn":       stub.dn,
+		"config.bind.password": stub.password,
+		"config.base":          "ou=hosts,dc=example,dc=com",
+		"config.filter":        "(objectClass=device)",
+		"config.pagesize":      "2",
+	}
+	g, err := newLdap(context.Background(), typeConfig("ldap", conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, g, []RawEntry{
+		{Source: "ws1.test.lan", Target: "10.0.0.1"},
+		{Source: "ws1-alias.test.lan", Target: "10.0.0.1"},
+		{Source: "ws2.example.com", Target: "10.0.0.2"},
+		{Source: "ws2.example.com", Target: "10.0.0.3"},
+	})
+
+	conf["config.bind.password"] = "wrong"
+	if _, err := newLdap(context.Background(), typeConfig("ldap", conf)); err == nil {
+		t.Error("expected bind error")
+	}
+	conf["config.bind.password"] = stub.password
+	conf["config.starttls"] = "false"
+	if _, err := newLdap(context.Background(), typeConfig("ldap", conf)); err == nil {
+		t.Error("expected error binding without TLS")
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import "context"
+
+// listgen is a generator that yields entries from a list prepared in advance.
+type listgen struct {
+	entries []*RawEntry
+}
+
+func newListgen(entries []*RawEntry) *listgen {
+	return &listgen{entries: entries}
+}
+
+func (l *listgen) Generate(ctx context.Context) (*RawEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.entries) == 0 {
+		return nil, nil
+	}
+	e := l.entries[0]
+	l.entries = l.entries[1:]
+	return e, nil
+}
+
+func (l *listgen) Close() error {
+	l.entries = nil
+	return nil
+}
@@ -5,85 +5,179 @@
 package gen
 
 import (
-	"database/sql"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 
 	"github.com/dullgiulio/kuradns/cfg"
 )
 
-type mysql struct {
-	ch    chan *RawEntry
-	errch chan error
-	rows  *sql.Rows
+func init() {
+	Register("mysql", newMysql, Meta{
+		Description: "Name and target pairs or typed records returned by a MySQL query",
+		Keys: []Key{
+			{Name: "config.user", Required: true},
+			{Name: "config.password", Secret: true},
+			{Name: "config.database", Required: true},
+			{Name: "config.query", Required: true},
+			{Name: "config.host", Default: "localhost"},
+			{Name: "config.port", Type: TypeInt, Default: "3306"},
+			{Name: "config.socket"},
+			{Name: "config.tls", Type: TypeBool, Default: "false"},
+			{Name: "config.ca"},
+			{Name: "config.insecure", Type: TypeBool, Default: "false"},
+			{Name: "config.auth", Default: "native", Values: []string{"native", "cleartext", "old"}},
+			{Name: "config.charset"},
+			{Name: "config.timeout", Type: TypeDuration, Default: "10s"},
+			{Name: "config.readtimeout", Type: TypeDuration},
+			{Name: "config.param.*"},
+		},
+	})
 }
 
-func newMysql(c *cfg.Config) (*mysql, error) {
+// newMysql returns a generator running config.query on MySQL database config.database.
+// The server is reached at config.host and config.port or through unix socket config.socket.
+// The password is optional, to allow logins authenticated by the socket. Named parameters
+// in the query, like :zone, are passed as arguments (see bindParams).
+//
+// config.tls enables TLS, verified against the certificates in config.ca if set or not
+// verified at all if config.insecure is true. config.auth selects the authentication:
+// native (default), cleartext, for server plugins like PAM, or old, for pre-4.1 passwords.
+func newMysql(ctx context.Context, c *cfg.Config) (Generator, error) {
+	query, ok := c.Get("config.query")
+	if !ok || query == "" {
+		return nil, errors.New("mysql query not specified")
+	}
+	mc, err := mysqlConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	params, err := sqlParams(c)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := bindParams(query, params, "?", true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mysql query: %s", err)
+	}
+	desc := fmt.Sprintf("mysql[%s@%s(%s)/%s]", mc.User, mc.Net, mc.Addr, mc.DBName)
+	return openSQL(ctx, "mysql", desc, mc.FormatDSN(), query, args)
+}
+
+// mysqlConfig returns the configuration of the MySQL driver described by c.
+func mysqlConfig(c *cfg.Config) (*mysql.Config, error) {
 	usr, ok := c.Get("config.user")
 	if !ok || usr == "" {
 		return nil, errors.New("mysql user not specified")
 	}
-	pwd, ok := c.Get("config.password")
-	if !ok || pwd == "" {
-		return nil, errors.New("mysql password not specified")
-	}
 	dbname, ok := c.Get("config.database")
 	if !ok || dbname == "" {
 		return nil, errors.New("mysql database name not specified")
 	}
-	query, ok := c.Get("config.query")
-	if !ok || query == "" {
-		return nil, errors.New("mysql query not specified")
-	}
-	host := c.GetVal("config.host", "localhost")
-	port := c.GetVal("config.port", "3306")
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", usr, pwd, host, port, dbname)
-	db, err := sql.Open("mysql", dsn)
+	timeout, err := c.GetDuration("config.timeout", 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to mysql[%s]: %s", dsn, err)
+		return nil, err
 	}
-	rows, err := db.Query(query)
+	readTimeout, err := c.GetDuration("config.readtimeout", 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query on mysql[%s]: %s", dsn, err)
-	}
-	m := &mysql{
-		ch:    make(chan *RawEntry, 100),
-		errch: make(chan error),
-		rows:  rows,
-	}
-	// rows is closed in run()
-	go func() {
-		m.run()
-		db.Close()
-	}()
-	return m, nil
-}
-
-func (m *mysql) run() {
-	defer m.rows.Close()
-	for m.rows.Next() {
-		entry := NewRawEntry("", "")
-		if err := m.rows.Scan(&entry.Source, &entry.Target); err != nil {
-			m.errch <- fmt.Errorf("mysql: error reading rows: %s", err)
-			continue
+		return nil, err
+	}
+	mc := &mysql.Config{
+		User:        usr,
+		Passwd:      c.GetVal("config.password", ""),
+		DBName:      dbname,
+		Timeout:     timeout,
+		ReadTimeout: readTimeout,
+		Loc:         time.UTC,
+	}
+	if charset := c.GetVal("config.charset", ""); charset != "" {
+		mc.Params = map[string]string{"charset": charset}
+	}
+	host := c.GetVal("config.host", "")
+	if socket, ok := c.Get("config.socket"); ok && socket != "" {
+		if _, ok := c.Get("config.host"); ok {
+			return nil, errors.New("mysql host and socket cannot be both specified")
 		}
-		if entry.Source == "" && entry.Target == "" {
-			log.Printf("[dns] mysql: skipping empty entry from database")
-			continue
+		mc.Net, mc.Addr = "unix", socket
+	} else {
+		mc.Net, mc.Addr = "tcp", net.JoinHostPort(host, c.GetVal("config.port", ""))
+	}
+	if mc.TLSConfig, err = mysqlTLS(c, host); err != nil {
+		return nil, err
+	}
+	switch auth := c.GetVal("config.auth", ""); auth {
+	case "native":
+	case "cleartext":
+		if mc.TLSConfig == "" && mc.Net != "unix" {
+			return nil, errors.New("mysql cleartext authentication requires TLS or a unix socket")
 		}
-		m.ch <- entry
+		mc.AllowCleartextPasswords = true
+	case "old":
+		mc.AllowOldPasswords = true
+	default:
+		return nil, fmt.Errorf("invalid mysql authentication '%s', expected native, cleartext or old", auth)
 	}
-	close(m.ch)
+	return mc, nil
 }
 
-func (m *mysql) Generate() (*RawEntry, error) {
-	select {
-	case re := <-m.ch:
-		return re, nil
-	case err := <-m.errch:
-		return nil, err
+// mysqlTLSConfigs holds the names of the TLS configurations registered with the MySQL driver.
+var mysqlTLSConfigs = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// mysqlTLS returns the name of the TLS configuration to connect to host or an empty
+// string if TLS is not enabled. Setting config.ca or config.insecure enables TLS, unless
+// config.tls is explicitly false, which is an error.
+//
+// The configurations are registered with the driver once and never modified, as the
+// driver reads them without locking; equal configurations share the same name.
+func mysqlTLS(c *cfg.Config, host string) (string, error) {
+	enabled, err := c.GetBool("config.tls", false)
+	if err != nil {
+		return "", err
+	}
+	insecure, err := c.GetBool("config.insecure", false)
+	if err != nil {
+		return "", err
+	}
+	ca := c.GetVal("config.ca", "")
+	if !enabled {
+		if ca == "" && !insecure {
+			return "", nil
+		}
+		if v, ok := c.Get("config.tls"); ok && v != "" {
+			return "", errors.New("mysql ca and insecure options cannot be used with tls disabled")
+		}
+	}
+	conf := &tls.Config{ServerName: host, InsecureSkipVerify: insecure}
+	var pem []byte
+	if ca != "" {
+		if pem, err = ioutil.ReadFile(ca); err != nil {
+			return "", fmt.Errorf("cannot read mysql ca: %s", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("no valid certificates in %s", ca)
+		}
+	}
+	name := fmt.Sprintf("kuradns-%x", sha256.Sum256([]byte(fmt.Sprintf("%s\x00%t\x00%s", host, insecure, pem))))
+	mysqlTLSConfigs.Lock()
+	defer mysqlTLSConfigs.Unlock()
+	if !mysqlTLSConfigs.names[name] {
+		if err := mysql.RegisterTLSConfig(name, conf); err != nil {
+			return "", fmt.Errorf("cannot configure mysql tls: %s", err)
+		}
+		mysqlTLSConfigs.names[name] = true
 	}
+	return name, nil
 }
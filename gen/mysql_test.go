@@ -0,0 +1,102 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMysqlConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kuradns-mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	ca := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := map[string]string{"config.user": "dns", "config.database": "domains"}
+	for _, tc := range []struct {
+		conf map[string]string
+		dsn  string
+	}{
+		{map[string]string{"config.password": "secret"}, "dns:secret@tcp(localhost:3306)/domains?timeout=10s"},
+		{map[string]string{"config.socket": "/run/mysqld/mysqld.sock", "config.auth": "cleartext"},
+			"dns@unix(/run/mysqld/mysqld.sock)/domains?allowCleartextPasswords=true&timeout=10s"},
+		{map[string]string{"config.host": "db.lan", "config.port": "3307", "config.readtimeout": "30s", "config.charset": "utf8mb4"},
+			"dns@tcp(db.lan:3307)/domains?readTimeout=30s&timeout=10s&charset=utf8mb4"},
+		{map[string]string{"config.host": "db.lan", "config.ca": ca, "config.timeout": "2s"},
+			"dns@tcp(db.lan:3306)/domains?timeout=2s&tls=kuradns-"},
+	} {
+		for k, v := range base {
+			tc.conf[k] = v
+		}
+		mc, err := mysqlConfig(typeConfig("mysql", tc.conf))
+		if err != nil {
+			t.Errorf("%v: %s", tc.conf, err)
+			continue
+		}
+		if dsn := mc.FormatDSN(); !strings.HasPrefix(dsn, tc.dsn) {
+			t.Errorf("%v: expected DSN %s, got %s", tc.conf, tc.dsn, dsn)
+		}
+	}
+
+	for _, conf := range []map[string]string{
+		{"config.user": ""},
+		{"config.database": ""},
+		{"config.host": "db.lan", "config.socket": "/run/mysqld/mysqld.sock"},
+		{"config.auth": "cleartext"},
+		{"config.auth": "kerberos"},
+		{"config.ca": filepath.Join(dir, "missing.pem")},
+		{"config.ca": ca, "config.tls": "false"},
+		{"config.insecure": "true", "config.tls": "false"},
+	} {
+		for k, v := range base {
+			if _, ok := conf[k]; !ok {
+				conf[k] = v
+			}
+		}
+		if _, err := mysqlConfig(typeConfig("mysql", conf)); err == nil {
+			t.Errorf("%v: expected error", conf)
+		}
+	}
+}
+
+func TestMysqlUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+	_, err = newMysql(context.Background(), typeConfig("mysql", map[string]string{
+		"config.user":     "dns",
+		"config.password": "secret",
+		"config.database": "domains",
+		"config.query":    "SELECT name, address FROM hosts",
+		"config.host":     host,
+		"config.port":     port,
+		"config.timeout":  "1s",
+	}))
+	if err == nil {
+		t.Fatal("expected error connecting to closed port")
+	}
+	if !strings.Contains(err.Error(), "failed to connect to mysql[dns@tcp(") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("unexpected error %s", err)
+	}
+}
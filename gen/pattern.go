@@ -0,0 +1,479 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("pattern", newPatterngen, Meta{
+		Description: "Entries expanded from patterns of numbered names",
+		Keys: []Key{
+			{Name: "config.pattern", Required: true, List: true},
+		},
+	})
+}
+
+// Maximum number of entries a pattern source can expand to.
+const maxPatternEntries = 1 << 16
+
+// newPatterngen returns a generator yielding the entries expanded from the patterns
+// in config.pattern, which can be repeated. See parsePattern for the syntax.
+func newPatterngen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	pats := c.GetList("config.pattern")
+	if pats == nil {
+		return nil, errors.New("pattern not specified")
+	}
+	zone := c.GetVal("dns.zone", "lan")
+	entries := make([]*RawEntry, 0)
+	for _, s := range pats {
+		p, err := parsePattern(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", s, err)
+		}
+		es, err := p.expand(zone, maxPatternEntries-len(entries))
+		if err != nil {
+			return nil, fmt.Errorf("cannot expand pattern '%s': %s", s, err)
+		}
+		entries = append(entries, es...)
+	}
+	return newListgen(entries), nil
+}
+
+// patternGroup is a set of alternative values in a name pattern.
+type patternGroup struct {
+	name string
+	// Another name of the group, if any
+	alias string
+	vals  []string
+}
+
+// pattern is a name template with groups of values and a target template.
+// Each entry of the expansion uses one value of each group.
+type pattern struct {
+	// Literal text around groups; there is one more part than groups.
+	parts  []string
+	groups []*patternGroup
+	target string
+	// The target is an IPv4 address
+	addr bool
+}
+
+// parsePattern parses a pattern of the form "NAME -> TARGET".
+//
+// NAME contains numeric ranges like [01-64], with zero padding if the first number
+// is padded, and lists like {a,b,c}. Groups can be named by prefixing them with a
+// name and a colon, as in [n:1-8] or {rack:a,b}. Other groups are named after the
+// word before them, as rack in rack{a,b}, unless that names more than one group,
+// and the only range without a name prefix is also called n. All groups can be
+// referred to by position as $1, $2, etc.
+//
+// TARGET contains expressions in braces. {n} is replaced by the value of group n
+// as it appears in the name and {#n} by its position in the group, starting at zero.
+// Expressions can use integers, + - * / % and parentheses, as in {n+10} or {#rack*16};
+// a group evaluates to its value if that is a number, to its position otherwise.
+// Targets made only of numbers, dots and expressions are IPv4 addresses: there {n}
+// is evaluated like an expression and the result is checked to be a valid address.
+func parsePattern(s string) (*pattern, error) {
+	i := strings.Index(s, "->")
+	if i < 0 {
+		return nil, errors.New("expected NAME -> TARGET")
+	}
+	name, target := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+2:])
+	if name == "" || target == "" {
+		return nil, errors.New("expected NAME -> TARGET")
+	}
+	p := &pattern{target: target, addr: isAddrTemplate(target)}
+	var (
+		lit   strings.Builder
+		words []string
+		// Ranges without a name prefix
+		ranges []*patternGroup
+	)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '[' && c != '{' {
+			if c == ']' || c == '}' {
+				return nil, fmt.Errorf("unexpected '%c'", c)
+			}
+			lit.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(name[i:], map[byte]byte{'[': ']', '{': '}'}[c])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated '%c'", c)
+		}
+		g, err := parseGroup(c, name[i+1:i+end])
+		if err != nil {
+			return nil, err
+		}
+		p.parts = append(p.parts, lit.String())
+		p.groups = append(p.groups, g)
+		var word string
+		if g.name == "" {
+			word = lastWord(lit.String())
+			if c == '[' {
+				ranges = append(ranges, g)
+			}
+		}
+		words = append(words, word)
+		lit.Reset()
+		i += end
+	}
+	p.parts = append(p.parts, lit.String())
+	p.nameGroups(words)
+	if len(ranges) == 1 && p.group("n") < 0 {
+		ranges[0].alias = "n"
+	}
+	// Check the target against the first expansion
+	if _, err := p.expandTarget(make([]int, len(p.groups))); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseGroup parses the content s of a range (kind '[') or a list (kind '{').
+// The group has no name unless s starts with one.
+func parseGroup(kind byte, s string) (*patternGroup, error) {
+	g := &patternGroup{}
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		if !isIdent(s[:i]) {
+			return nil, fmt.Errorf("invalid group name '%s'", s[:i])
+		}
+		g.name, s = s[:i], s[i+1:]
+	}
+	if kind == '{' {
+		g.vals = strings.Split(s, ",")
+		for _, v := range g.vals {
+			if v == "" {
+				return nil, fmt.Errorf("empty value in {%s}", s)
+			}
+		}
+		return g, nil
+	}
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		return nil, fmt.Errorf("expected range [FROM-TO], got [%s]", s)
+	}
+	from, err1 := strconv.Atoi(s[:i])
+	to, err2 := strconv.Atoi(s[i+1:])
+	if err1 != nil || err2 != nil || from < 0 || to < from {
+		return nil, fmt.Errorf("invalid range [%s]", s)
+	}
+	if to-from >= maxPatternEntries {
+		return nil, fmt.Errorf("range [%s] is too large", s)
+	}
+	format := "%d"
+	if len(s[:i]) > 1 && s[0] == '0' {
+		format = fmt.Sprintf("%%0%dd", i)
+	}
+	for n := from; n <= to; n++ {
+		g.vals = append(g.vals, fmt.Sprintf(format, n))
+	}
+	return g, nil
+}
+
+// nameGroups names the groups without a name after the words before them in the
+// name, unless a word is the name of another group.
+func (p *pattern) nameGroups(words []string) {
+	used := make(map[string]int)
+	for i, g := range p.groups {
+		if g.name != "" {
+			used[g.name]++
+		} else if words[i] != "" {
+			used[words[i]]++
+		}
+	}
+	for i, g := range p.groups {
+		if words[i] != "" && used[words[i]] == 1 {
+			g.name = words[i]
+		}
+	}
+}
+
+// lastWord returns the group name at the end of s, if any.
+func lastWord(s string) string {
+	i := len(s)
+	for i > 0 && isIdent("_"+s[i-1:i]) {
+		i--
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[i:]
+}
+
+// isAddrTemplate returns true if target has only numbers and dots outside of braces.
+func isAddrTemplate(target string) bool {
+	var (
+		lit   strings.Builder
+		depth int
+	)
+	for _, c := range target {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case depth == 0:
+			lit.WriteRune(c)
+		}
+	}
+	return strings.Contains(lit.String(), ".") && strings.Trim(lit.String(), "0123456789.") == ""
+}
+
+// isIdent returns true if s is a valid group name.
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// expand returns all entries described by p, at most max. Names without dots are
+// considered to be inside zone.
+func (p *pattern) expand(zone string, max int) ([]*RawEntry, error) {
+	total := 1
+	for _, g := range p.groups {
+		total *= len(g.vals)
+		if total > max {
+			return nil, fmt.Errorf("more than %d entries", maxPatternEntries)
+		}
+	}
+	entries := make([]*RawEntry, 0, total)
+	idx := make([]int, len(p.groups))
+	for {
+		var name strings.Builder
+		for i, g := range p.groups {
+			name.WriteString(p.parts[i])
+			name.WriteString(g.vals[idx[i]])
+		}
+		name.WriteString(p.parts[len(p.parts)-1])
+		target, err := p.expandTarget(idx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name.String(), err)
+		}
+		entries = append(entries, NewRawEntry(qualify(name.String(), zone), target))
+		// Advance to the next combination, last group first
+		i := len(idx) - 1
+		for ; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < len(p.groups[i].vals) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			return entries, nil
+		}
+	}
+}
+
+// expandTarget returns the target for the combination of group values idx.
+func (p *pattern) expandTarget(idx []int) (string, error) {
+	var b strings.Builder
+	s := p.target
+	for {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			if strings.IndexByte(s, '}') >= 0 {
+				return "", errors.New("unexpected '}' in target")
+			}
+			b.WriteString(s)
+			break
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", errors.New("unterminated '{' in target")
+		}
+		b.WriteString(s[:i])
+		v, err := p.eval(s[i+1:i+end], idx)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		s = s[i+end+1:]
+	}
+	return checkIPv4(b.String())
+}
+
+// checkIPv4 normalizes target if it is made only of numbers and dots, returning an
+// error if it is not a valid IPv4 address.
+func checkIPv4(target string) (string, error) {
+	if strings.Trim(target, "0123456789.-") != "" {
+		return target, nil
+	}
+	octets := strings.Split(target, ".")
+	if len(octets) != 4 {
+		return "", fmt.Errorf("invalid address %s", target)
+	}
+	for i, o := range octets {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 || n > 255 {
+			return "", fmt.Errorf("invalid address %s", target)
+		}
+		octets[i] = strconv.Itoa(n)
+	}
+	return strings.Join(octets, "."), nil
+}
+
+// group returns the index of the group called name or -1.
+func (p *pattern) group(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, g := range p.groups {
+		if g.name == name || fmt.Sprintf("$%d", i+1) == name {
+			return i
+		}
+	}
+	for i, g := range p.groups {
+		if g.alias == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// eval evaluates the expression expr for the combination of group values idx.
+func (p *pattern) eval(expr string, idx []int) (string, error) {
+	expr = strings.TrimSpace(expr)
+	// A plain group name is replaced with the value as it appears in the name,
+	// except in addresses where it is evaluated
+	if i := p.group(expr); i >= 0 && !p.addr {
+		return p.groups[i].vals[idx[i]], nil
+	}
+	e := &patternExpr{s: expr, p: p, idx: idx}
+	n, err := e.sum()
+	if err != nil {
+		return "", fmt.Errorf("{%s}: %s", expr, err)
+	}
+	if e.skip(); e.i < len(e.s) {
+		return "", fmt.Errorf("{%s}: unexpected '%s'", expr, e.s[e.i:])
+	}
+	return strconv.Itoa(n), nil
+}
+
+// patternExpr is an arithmetic expression in a target template.
+type patternExpr struct {
+	s   string
+	i   int
+	p   *pattern
+	idx []int
+}
+
+func (e *patternExpr) skip() {
+	for e.i < len(e.s) && e.s[e.i] == ' ' {
+		e.i++
+	}
+}
+
+// sum parses terms separated by + and -.
+func (e *patternExpr) sum() (int, error) {
+	n, err := e.product()
+	if err != nil {
+		return 0, err
+	}
+	for e.skip(); e.i < len(e.s) && (e.s[e.i] == '+' || e.s[e.i] == '-'); e.skip() {
+		op := e.s[e.i]
+		e.i++
+		m, err := e.product()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			n += m
+		} else {
+			n -= m
+		}
+	}
+	return n, nil
+}
+
+// product parses factors separated by *, / and %.
+func (e *patternExpr) product() (int, error) {
+	n, err := e.factor()
+	if err != nil {
+		return 0, err
+	}
+	for e.skip(); e.i < len(e.s) && strings.IndexByte("*/%", e.s[e.i]) >= 0; e.skip() {
+		op := e.s[e.i]
+		e.i++
+		m, err := e.factor()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case op == '*':
+			n *= m
+		case m == 0:
+			return 0, errors.New("division by zero")
+		case op == '/':
+			n /= m
+		default:
+			n %= m
+		}
+	}
+	return n, nil
+}
+
+// factor parses a number, a group reference or an expression in parentheses.
+func (e *patternExpr) factor() (int, error) {
+	e.skip()
+	if e.i >= len(e.s) {
+		return 0, errors.New("unexpected end of expression")
+	}
+	if e.s[e.i] == '(' {
+		e.i++
+		n, err := e.sum()
+		if err != nil {
+			return 0, err
+		}
+		if e.skip(); e.i >= len(e.s) || e.s[e.i] != ')' {
+			return 0, errors.New("expected ')'")
+		}
+		e.i++
+		return n, nil
+	}
+	pos := e.s[e.i] == '#'
+	if pos {
+		e.i++
+	}
+	start := e.i
+	for e.i < len(e.s) && (isIdent(e.s[start:e.i+1]) || (e.i == start && e.s[e.i] == '$') ||
+		(e.s[e.i] >= '0' && e.s[e.i] <= '9')) {
+		e.i++
+	}
+	tok := e.s[start:e.i]
+	if tok == "" {
+		return 0, fmt.Errorf("unexpected '%s'", e.s[e.i:])
+	}
+	if n, err := strconv.Atoi(tok); err == nil && !pos {
+		return n, nil
+	}
+	g := e.p.group(tok)
+	if g < 0 {
+		return 0, fmt.Errorf("unknown group '%s'", tok)
+	}
+	if !pos {
+		if n, err := strconv.Atoi(e.p.groups[g].vals[e.idx[g]]); err == nil {
+			return n, nil
+		}
+	}
+	return e.idx[g], nil
+}
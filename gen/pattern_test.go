@@ -0,0 +1,118 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"testing"
+)
+
+func TestPatternExpand(t *testing.T) {
+	for pat, expected := range map[string][]RawEntry{
+		"node[n:01-03].rack{rack:a,b}.lan -> 10.0.{#rack+1}.{n}": {
+			{Source: "node01.racka.lan", Target: "10.0.1.1"},
+			{Source: "node01.rackb.lan", Target: "10.0.2.1"},
+			{Source: "node02.racka.lan", Target: "10.0.1.2"},
+			{Source: "node02.rackb.lan", Target: "10.0.2.2"},
+			{Source: "node03.racka.lan", Target: "10.0.1.3"},
+			{Source: "node03.rackb.lan", Target: "10.0.2.3"},
+		},
+		"gpu[8-10] -> 192.168.{$1 / 10}.{($1 % 10) * 16 + 1}": {
+			{Source: "gpu8.lab", Target: "192.168.0.129"},
+			{Source: "gpu9.lab", Target: "192.168.0.145"},
+			{Source: "gpu10.lab", Target: "192.168.1.1"},
+		},
+		"web[1-2].{a,b}.lab -> 10.{web}.{$2}.{n}": {
+			{Source: "web1.a.lab", Target: "10.1.0.1"},
+			{Source: "web1.b.lab", Target: "10.1.1.1"},
+			{Source: "web2.a.lab", Target: "10.2.0.2"},
+			{Source: "web2.b.lab", Target: "10.2.1.2"},
+		},
+		"x[1-2].x[3-4] -> 10.0.{$1}.{$2}": {
+			{Source: "x1.x3", Target: "10.0.1.3"},
+			{Source: "x1.x4", Target: "10.0.1.4"},
+			{Source: "x2.x3", Target: "10.0.2.3"},
+			{Source: "x2.x4", Target: "10.0.2.4"},
+		},
+		"{www,api}.lab -> front-{$1}.example.com": {
+			{Source: "www.lab", Target: "front-www.example.com"},
+			{Source: "api.lab", Target: "front-api.example.com"},
+		},
+	} {
+		p, err := parsePattern(pat)
+		if err != nil {
+			t.Errorf("%s: %s", pat, err)
+			continue
+		}
+		entries, err := p.expand("lab", maxPatternEntries)
+		if err != nil {
+			t.Errorf("%s: %s", pat, err)
+			continue
+		}
+		if len(entries) != len(expected) {
+			t.Errorf("%s: expected %d entries, got %d", pat, len(expected), len(entries))
+			continue
+		}
+		for i := range expected {
+			if *entries[i] != expected[i] {
+				t.Errorf("%s: entry %d: expected %v, got %v", pat, i, expected[i], *entries[i])
+			}
+		}
+	}
+}
+
+func TestPatternUnnamed(t *testing.T) {
+	pat := "node[01-64].rack{a,b}.lan -> 10.0.{rack}.{n}"
+	p, err := parsePattern(pat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := p.expand("lan", maxPatternEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 128 {
+		t.Fatalf("expected 128 entries, got %d", len(entries))
+	}
+	for i, expected := range map[int]RawEntry{
+		0:   {Source: "node01.racka.lan", Target: "10.0.0.1"},
+		1:   {Source: "node01.rackb.lan", Target: "10.0.1.1"},
+		127: {Source: "node64.rackb.lan", Target: "10.0.1.64"},
+	} {
+		if *entries[i] != expected {
+			t.Errorf("entry %d: expected %v, got %v", i, expected, *entries[i])
+		}
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	for _, pat := range []string{
+		"node[1-4].lan",
+		"node[4-1].lan -> 10.0.0.{$1}",
+		"node[1-4.lan -> 10.0.0.{$1}",
+		"node{a,}.lan -> 10.0.0.1",
+		"node[1-4].lan -> 10.0.0.{x}",
+		"x[1-2].x[3-4] -> 10.0.{x}.1",
+		"a[1-2].b[3-4] -> 10.0.{n}.1",
+		"node[1-4].lan -> 10.0.0.{$1 * 100}",
+		"node[1-4].lan -> 10.0.0.{$1 / 0}",
+		"node[1-4].lan -> 10.0.{$1 - 2}.1",
+		"node[1-4].lan -> 10.0.0.{($1 + 1}",
+	} {
+		p, err := parsePattern(pat)
+		if err == nil {
+			_, err = p.expand("lan", maxPatternEntries)
+		}
+		if err == nil {
+			t.Errorf("expected error for %s", pat)
+		}
+	}
+	p, err := parsePattern("n[0-999].r[0-999].lan -> 10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.expand("lan", maxPatternEntries); err == nil {
+		t.Error("expected error for too many entries")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("records", newRecfile, Meta{
+		Description: "Typed records in a JSON or YAML file",
+		Keys: []Key{
+			{Name: "config.path", Required: true},
+			{Name: "config.format", Values: []string{"json", "yaml"}},
+			{Name: "config.watch", Type: TypeDuration},
+		},
+	})
+}
+
+// newRecfile returns a generator yielding the records listed in the JSON or YAML
+// file at config.path. The format is taken from config.format or from the file extension.
+func newRecfile(ctx context.Context, c *cfg.Config) (Generator, error) {
+	path, ok := c.Get("config.path")
+	if !ok || path == "" {
+		return nil, errors.New("records file path not specified")
+	}
+	format := c.GetVal("config.format", fileFormat(path, "json"))
+	if format != "json" && format != "yaml" {
+		return nil, fmt.Errorf("unknown records format '%s'", format)
+	}
+	return newFilegen(ctx, c, path, format, "records file")
+}
+
+// parseRecords reads a document in format (json or yaml) from r. The document is
+// either a list of records or an object with the list under "records". Each record
+// has a name and a target and optionally a type and a TTL. MX and SRV records can
+// have a priority, SRV records a weight and a port; TXT records have data instead of
+// a target. Names without dots are considered to be inside zone.
+func parseRecords(r io.Reader, format, zone string) ([]*RawEntry, error) {
+	var (
+		doc interface{}
+		err error
+	)
+	switch format {
+	case "json":
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	case "yaml":
+		err = yaml.NewDecoder(r).Decode(&doc)
+		doc = stringKeys(doc)
+	default:
+		return nil, fmt.Errorf("unknown records format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		doc = m["records"]
+	}
+	list, ok := doc.([]interface{})
+	if !ok {
+		return nil, errors.New("expected a list of records")
+	}
+	entries := make([]*RawEntry, 0, len(list))
+	for i, v := range list {
+		rec, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %d: expected an object", i+1)
+		}
+		e, err := recordEntry(rec, zone)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// stringKeys converts the mappings in v, as decoded from YAML, to maps with
+// string keys like those decoded from JSON.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeys(v[i])
+		}
+	}
+	return v
+}
+
+// parseRecordLines reads records from r, one JSON object per line, in the same form
+// as the records read by parseRecords. Empty lines are ignored.
+func parseRecordLines(r io.Reader, zone string) ([]*RawEntry, error) {
+	entries := make([]*RawEntry, 0)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		b := bytes.TrimSpace(s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var rec map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		e, err := recordEntry(rec, zone)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// recordEntry converts a decoded record into an entry.
+func recordEntry(rec map[string]interface{}, zone string) (*RawEntry, error) {
+	for k := range rec {
+		switch k {
+		case "name", "target", "type", "ttl", "priority", "weight", "port", "data":
+		default:
+			return nil, fmt.Errorf("unknown field '%s'", k)
+		}
+	}
+	name := recordField(rec, "name")
+	if name == "" {
+		return nil, errors.New("name not specified")
+	}
+	e := NewRawEntry(qualify(name, zone), recordField(rec, "target"))
+	err := parseFields(e, func(k string) string {
+		return recordField(rec, k)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if err := e.Check(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// parseFields sets the type, TTL, priority, weight, port and data of e to the
+// values returned by field for each of their names. Empty values are ignored.
+func parseFields(e *RawEntry, field func(k string) string) error {
+	var err error
+	e.Data = field("data")
+	if e.Type, err = ParseType(field("type")); err != nil {
+		return err
+	}
+	if ttl := field("ttl"); ttl != "" {
+		if e.TTL, err = ParseTTL(ttl); err != nil {
+			return err
+		}
+	}
+	for k, p := range map[string]*uint16{"priority": &e.Priority, "weight": &e.Weight, "port": &e.Port} {
+		v := field(k)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s'", k, v)
+		}
+		*p = uint16(n)
+	}
+	return nil
+}
+
+// recordField returns the value of field k as a string.
+func recordField(rec map[string]interface{}, k string) string {
+	switch v := rec[k].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecords(t *testing.T) {
+	expected := []RawEntry{
+		{Source: "www.lan", Target: "10.0.0.1"},
+		{Source: "docs.lan", Target: "pages.example.com", Type: "CNAME", TTL: 5 * time.Minute},
+	}
+	for format, data := range map[string]string{
+		"json": `[{"name": "www", "target": "10.0.0.1"},
+			{"name": "docs.lan", "target": "pages.example.com", "type": "cname", "ttl": 300}]`,
+		"yaml": `records:
+- name: www
+  target: 10.0.0.1
+- {name: docs.lan, target: pages.example.com, type: CNAME, ttl: 5m}
+`,
+	} {
+		entries, err := parseRecords(strings.NewReader(data), format, "lan")
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+			continue
+		}
+		if len(entries) != len(expected) {
+			t.Errorf("%s: expected %d entries, got %d", format, len(expected), len(entries))
+			continue
+		}
+		for i := range expected {
+			if *entries[i] != expected[i] {
+				t.Errorf("%s: entry %d: expected %v, got %v", format, i, expected[i], *entries[i])
+			}
+		}
+	}
+}
+
+func TestParseRecordsErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"name": "a", "target": "b"}`,
+		`[{"name": "a"}]`,
+		`[{"name": "a", "target": "b", "type": "HINFO"}]`,
+		`[{"name": "a", "target": "b", "ttl": "soon"}]`,
+		`[{"name": "a", "target": "b", "tll": 5}]`,
+	} {
+		if _, err := parseRecords(strings.NewReader(data), "json", "lan"); err == nil {
+			t.Errorf("expected error parsing %s", data)
+		}
+	}
+}
+
+func TestParseRecordsYAMLScalars(t *testing.T) {
+	data := `# numbers and flow mappings
+- name: www
+  target: 10.0.0.1
+  ttl: 300
+- {name: "alias", target: 'www.lan', type: cname}
+`
+	entries, err := parseRecords(strings.NewReader(data), "yaml", "lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RawEntry{
+		{Source: "www.lan", Target: "10.0.0.1", TTL: 5 * time.Minute},
+		{Source: "alias.lan", Target: "www.lan", Type: "CNAME"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i := range expected {
+		if *entries[i] != expected[i] {
+			t.Errorf("entry %d: expected %v, got %v", i, expected[i], *entries[i])
+		}
+	}
+	if _, err := parseRecords(strings.NewReader("- name: [unterminated\n"), "yaml", "lan"); err == nil {
+		t.Error("expected error for invalid YAML")
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("redis", newRedis, Meta{
+		Description: "String keys under a prefix in Redis",
+		Keys: []Key{
+			{Name: "config.prefix", Required: true},
+			{Name: "config.address", Default: "127.0.0.1:6379"},
+			{Name: "config.user"},
+			{Name: "config.password", Secret: true},
+			{Name: "config.db", Type: TypeInt, Default: "0"},
+			{Name: "config.timeout", Type: TypeDuration, Default: "10s"},
+		},
+	})
+}
+
+// Number of keys requested in each SCAN and MGET call.
+const redisBatch = 1000
+
+// redisConn is a connection to a Redis server speaking the RESP protocol.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedis returns a generator yielding an entry for each string key under config.prefix in
+// the Redis server at config.address (default 127.0.0.1:6379). The name is the key without
+// the prefix and the target is the value. config.password (and config.user for ACL users)
+// authenticate the connection and config.db selects the database.
+func newRedis(ctx context.Context, c *cfg.Config) (Generator, error) {
+	prefix, ok := c.Get("config.prefix")
+	if !ok || prefix == "" {
+		return nil, errors.New("redis key prefix not specified")
+	}
+	timeout, err := c.GetDuration("config.timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	db, err := c.GetInt("config.db", 0)
+	if err != nil {
+		return nil, err
+	}
+	address := c.GetVal("config.address", "")
+	conn, err := dialContext(ctx, "tcp", address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to redis: %s", err)
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+	conn.SetDeadline(time.Now().Add(timeout))
+	rc := &redisConn{conn: conn, r: bufio.NewReaderSize(conn, redisMaxLine)}
+
+	if password, ok := c.Get("config.password"); ok && password != "" {
+		args := []string{"AUTH", password}
+		if user, ok := c.Get("config.user"); ok && user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := rc.do(args...); err != nil {
+			return nil, fmt.Errorf("cannot authenticate to redis: %s", err)
+		}
+	}
+	if db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(db)); err != nil {
+			return nil, fmt.Errorf("cannot select redis database %d: %s", db, err)
+		}
+	}
+	kvs, err := rc.scanPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read redis keys: %s", err)
+	}
+	return newListgen(kvEntries(kvs, prefix, c.GetVal("dns.zone", "lan"))), nil
+}
+
+// scanPrefix returns all string keys starting with prefix and their values.
+func (rc *redisConn) scanPrefix(prefix string) (map[string]string, error) {
+	match := redisGlobEscape(prefix) + "*"
+	var keys []string
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply, err := rc.do("SCAN", cursor, "MATCH", match, "COUNT", strconv.Itoa(redisBatch))
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, errors.New("unexpected SCAN reply")
+		}
+		cursor, _ = parts[0].(string)
+		found, _ := parts[1].([]interface{})
+		for _, k := range found {
+			// SCAN may return a key more than once.
+			if k, ok := k.(string); ok && !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	kvs := make(map[string]string, len(keys))
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > redisBatch {
+			n = redisBatch
+		}
+		reply, err := rc.do(append([]string{"MGET"}, keys[:n]...)...)
+		if err != nil {
+			return nil, err
+		}
+		vals, ok := reply.([]interface{})
+		if !ok || len(vals) != n {
+			return nil, errors.New("unexpected MGET reply")
+		}
+		for i, v := range vals {
+			// Keys deleted meanwhile or not holding strings are nil.
+			if v, ok := v.(string); ok {
+				kvs[keys[i]] = v
+			}
+		}
+		keys = keys[n:]
+	}
+	return kvs, nil
+}
+
+// do sends a command and returns its reply: a string, an int64, nil or a []interface{}
+// of those. Error replies are returned as errors.
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(rc.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return rc.reply()
+}
+
+// Limits on the replies of the server: the longest line, the longest string, the most
+// elements of an array and the deepest nesting of arrays.
+const (
+	redisMaxLine  = 64 << 10
+	redisMaxBulk  = 1 << 20
+	redisMaxArray = 1 << 16
+	redisMaxDepth = 8
+)
+
+// reply reads a reply from the server.
+func (rc *redisConn) reply() (interface{}, error) {
+	return rc.readReply(0)
+}
+
+// readReply reads a reply nested in depth arrays.
+func (rc *redisConn) readReply(depth int) (interface{}, error) {
+	// Lines must fit in the buffer of the reader, at most redisMaxLine bytes.
+	b, err := rc.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errors.New("redis reply line too long")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line := strings.TrimSuffix(string(b), "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk length '%s'", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > redisMaxBulk {
+			return nil, fmt.Errorf("redis bulk reply too long (%d bytes)", n)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis array length '%s'", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > redisMaxArray {
+			return nil, fmt.Errorf("redis array reply too long (%d elements)", n)
+		}
+		if depth >= redisMaxDepth {
+			return nil, errors.New("redis array reply nested too deeply")
+		}
+		// Elements are appended as they are read, so that memory is only
+		// allocated for data actually sent by the server.
+		var vals []interface{}
+		for i := 0; i < n; i++ {
+			v, err := rc.readReply(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return vals, nil
+	}
+	return nil, fmt.Errorf("unknown redis reply type '%c'", line[0])
+}
+
+// redisGlobEscape escapes the characters of s special in SCAN MATCH patterns.
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeRedis serves the commands used by the redis generator on a listener.
+func fakeRedis(t *testing.T, data map[string]string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveRedis(conn, data)
+		}
+	}()
+	return l
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func serveRedis(conn net.Conn, data map[string]string) {
+	defer conn.Close()
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	authed := false
+	for {
+		req, err := rc.reply()
+		if err != nil {
+			return
+		}
+		parts, _ := req.([]interface{})
+		args := make([]string, len(parts))
+		for i := range parts {
+			args[i], _ = parts[i].(string)
+		}
+		if args[0] != "AUTH" && !authed {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch args[0] {
+		case "AUTH":
+			if args[len(args)-1] != "s3cr3t" {
+				fmt.Fprint(conn, "-WRONGPASS invalid username-password pair\r\n")
+				continue
+			}
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "SCAN":
+			var keys []string
+			for k := range data {
+				// Redis glob escapes match path.Match ones for the patterns used here.
+				if ok, _ := path.Match(args[3], k); ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			// Two pages, the second repeating a key as SCAN may do.
+			half := len(keys) / 2
+			page, next := keys[:half+1], "1"
+			if args[1] == "1" {
+				page, next = keys[half:], "0"
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "*2\r\n%s*%d\r\n", bulk(next), len(page))
+			for _, k := range page {
+				b.WriteString(bulk(k))
+			}
+			fmt.Fprint(conn, b.String())
+		case "MGET":
+			var b strings.Builder
+			fmt.Fprintf(&b, "*%d\r\n", len(args)-1)
+			for _, k := range args[1:] {
+				if v, ok := data[k]; ok {
+					b.WriteString(bulk(v))
+				} else {
+					b.WriteString("$-1\r\n")
+				}
+			}
+			fmt.Fprint(conn, b.String())
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	l := fakeRedis(t, map[string]string{
+		"dns:web":   "10.0.0.1",
+		"dns:db":    "10.0.0.2",
+		"dns:cache": " 10.0.0.3\n",
+		"dns*x":     "10.0.0.8",
+		"other:web": "10.0.0.9",
+	})
+	defer l.Close()
+
+	conf := map[string]string{
+		"dns.zone":        "test.lan",
+		"config.address":  l.Addr().String(),
+		"config.prefix":   "dns:",
+		"config.password": "s3cr3t",
+		"config.db":       "2",
+	}
+	g, err := newRedis(context.Background(), typeConfig("redis", conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, g, []RawEntry{
+		{Source: "cache.test.lan", Target: "10.0.0.3"},
+		{Source: "db.test.lan", Target: "10.0.0.2"},
+		{Source: "web.test.lan", Target: "10.0.0.1"},
+	})
+
+	conf["config.password"] = "wrong"
+	if _, err := newRedis(context.Background(), typeConfig("redis", conf)); err == nil {
+		t.Error("expected authentication error")
+	}
+}
+
+func TestRedisReplyLimits(t *testing.T) {
+	for _, reply := range []string{
+		"$9223372036854775807\r\n",
+		"$2097152\r\n",
+		"*9223372036854775807\r\n",
+		"*1000000000\r\n",
+		strings.Repeat("*1\r\n", redisMaxDepth+1) + ":1\r\n",
+		"+" + strings.Repeat("x", redisMaxLine) + "\r\n",
+		"-" + strings.Repeat("x", redisMaxLine) + "\r\n",
+		":" + strings.Repeat("1", redisMaxLine) + "\r\n",
+	} {
+		rc := &redisConn{r: bufio.NewReaderSize(strings.NewReader(reply), redisMaxLine)}
+		if _, err := rc.reply(); err == nil {
+			t.Errorf("expected error reading %q", reply)
+		}
+	}
+	rc := &redisConn{r: bufio.NewReaderSize(strings.NewReader("*2\r\n*0\r\n$2\r\nok\r\n"), redisMaxLine)}
+	if v, err := rc.reply(); err != nil || fmt.Sprint(v) != "[[] ok]" {
+		t.Errorf("unexpected reply %v: %v", v, err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+// Factory returns a new generator configured by conf. Work done to prepare the
+// generator, such as running queries or fetching documents, is aborted when ctx is done.
+type Factory func(ctx context.Context, conf *cfg.Config) (Generator, error)
+
+// Meta describes a type of generator.
+type Meta struct {
+	// Short description of the generator
+	Description string
+	// Configuration keys accepted, with their types and defaults
+	Keys []Key
+}
+
+type registration struct {
+	factory  Factory
+	meta     Meta
+	defaults map[string]string
+}
+
+var (
+	registryMux sync.RWMutex
+	registry    = make(map[string]*registration)
+)
+
+// Register makes a type of generator available by name. It is meant to be called
+// from init functions and panics if name is already registered or factory is nil.
+func Register(name string, factory Factory, meta Meta) {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+	if factory == nil {
+		panic("gen: Register factory is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("gen: Register called twice for %s", name))
+	}
+	registry[name] = &registration{factory: factory, meta: meta, defaults: keyDefaults(meta.Keys)}
+}
+
+// keyDefaults returns the default values of keys by name.
+func keyDefaults(keys []Key) map[string]string {
+	defaults := make(map[string]string)
+	for _, k := range keys {
+		if k.Default != "" && !k.List && !strings.HasSuffix(k.Name, ".*") {
+			defaults[k.Name] = k.Default
+		}
+	}
+	return defaults
+}
+
+// unregister removes the type of generator called name, for tests.
+func unregister(name string) {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+	delete(registry, name)
+}
+
+// Types returns the sorted names of the registered types of generator.
+func Types() []string {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TypeMeta returns the description of the type of generator called name.
+func TypeMeta(name string) (Meta, bool) {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	r, ok := registry[name]
+	if !ok {
+		return Meta{}, false
+	}
+	return r.meta, true
+}
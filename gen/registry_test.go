@@ -0,0 +1,83 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+// typeConfig returns a configuration with the values in m and the defaults of the type of generator called name.
+func typeConfig(name string, m map[string]string) *cfg.Config {
+	meta, ok := TypeMeta(name)
+	if !ok {
+		panic("unknown type of generator " + name)
+	}
+	if m == nil {
+		m = make(map[string]string)
+	}
+	return cfg.FromMap(m).WithDefaults(keyDefaults(meta.Keys))
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-registry", func(_ context.Context, c *cfg.Config) (Generator, error) {
+		return newListgen([]*RawEntry{NewRawEntry("a.lan", c.GetVal("config.target", ""))}), nil
+	}, Meta{Description: "Test", Keys: []Key{{Name: "config.target"}}})
+	defer unregister("test-registry")
+
+	meta, ok := TypeMeta("test-registry")
+	if !ok || meta.Description != "Test" {
+		t.Fatalf("unexpected meta %v", meta)
+	}
+	var found bool
+	for _, name := range Types() {
+		found = found || name == "test-registry"
+	}
+	if !found {
+		t.Error("registered type not listed")
+	}
+	g, err := MakeGenerator(context.Background(), "test-registry", cfg.FromMap(map[string]string{"config.target": "10.0.0.1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := g.Generate(context.Background()); e == nil || e.Target != "10.0.0.1" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if _, err := MakeGenerator(context.Background(), "missing", cfg.NewConfig()); err != ErrInvalidGenerator {
+		t.Errorf("expected ErrInvalidGenerator, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic registering a type twice")
+		}
+	}()
+	Register("static", newStaticgen, Meta{})
+}
+
+func TestMakeGeneratorDefaults(t *testing.T) {
+	Register("test-defaults", func(_ context.Context, c *cfg.Config) (Generator, error) {
+		c.Put("cache.seen", "yes")
+		return newListgen([]*RawEntry{NewRawEntry(c.GetVal("config.name", ""), c.GetVal("config.target", ""))}), nil
+	}, Meta{Keys: []Key{{Name: "config.name", Default: "a.lan"}, {Name: "config.target", Default: "10.0.0.1"}}})
+	defer unregister("test-defaults")
+
+	conf := cfg.FromMap(map[string]string{"config.target": "10.0.0.2"})
+	g, err := MakeGenerator(context.Background(), "test-defaults", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := g.Generate(context.Background()); e == nil || e.Source != "a.lan" || e.Target != "10.0.0.2" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if _, ok := conf.Get("config.name"); ok {
+		t.Error("default stored in the configuration")
+	}
+	if v, _ := conf.Get("cache.seen"); v != "yes" {
+		t.Error("key put by the generator not stored in the configuration")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+// KeyType is the type of the value of a configuration key.
+type KeyType string
+
+// Types of configuration values. The empty type is a string.
+const (
+	TypeString   KeyType = "string"
+	TypeInt      KeyType = "int"
+	TypeBool     KeyType = "bool"
+	TypeFloat    KeyType = "float"
+	TypeDuration KeyType = "duration"
+)
+
+// Key describes a configuration key of a type of generator.
+type Key struct {
+	// Name of the key, like config.path. A name ending in ".*", like config.header.*,
+	// stands for all keys with that prefix.
+	Name string
+	// Type of the value
+	Type KeyType
+	// Value used when the key is not set, applied by MakeGenerator
+	Default string
+	// The key must be set to a non-empty value
+	Required bool
+	// The key can be repeated, as config.name.0, config.name.1, etc.
+	List bool
+	// The value must not be shown, as for passwords
+	Secret bool
+	// Allowed values, if limited
+	Values []string
+}
+
+// commonKeys are the keys that the server reads for all types of generator.
+var commonKeys = []Key{
+	{Name: "config.refresh", Type: TypeDuration},
+	{Name: "config.refresh.jitter", Type: TypeFloat, Default: "0.1"},
+	{Name: "config.refresh.backoff", Type: TypeDuration},
+}
+
+// CommonKeys returns the configuration keys accepted by all types of generator.
+func CommonKeys() []Key {
+	return append([]Key(nil), commonKeys...)
+}
+
+// Schema returns the configuration keys of the type of generator called name.
+func Schema(name string) ([]Key, bool) {
+	meta, ok := TypeMeta(name)
+	if !ok {
+		return nil, false
+	}
+	return append([]Key(nil), meta.Keys...), true
+}
+
+// Validate checks the configuration keys in conf against the schema of the type of
+// generator called name. All unknown keys, invalid values and missing required keys
+// are reported in the returned error.
+func Validate(name string, conf *cfg.Config) error {
+	keys, ok := Schema(name)
+	if !ok {
+		return fmt.Errorf("unknown source type '%s'", name)
+	}
+	keys = append(keys, commonKeys...)
+	m := conf.Prefixed("config.")
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, "config."+k)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, n := range names {
+		key, ok := findKey(keys, n)
+		if !ok {
+			errs = append(errs, unknownKey(keys, n))
+			continue
+		}
+		if err := key.check(m[strings.TrimPrefix(n, "config.")]); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", n, err))
+		}
+	}
+	for _, key := range keys {
+		if key.Required && !key.isSet(conf) {
+			errs = append(errs, fmt.Sprintf("%s: required key not set", key.Name))
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("invalid configuration for source type %s: %s", name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// findKey returns the key in keys that matches the configuration key n.
+func findKey(keys []Key, n string) (Key, bool) {
+	for _, k := range keys {
+		if k.matches(n) {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// unknownKey describes the error of an unknown key n, suggesting the most similar key.
+func unknownKey(keys []Key, n string) string {
+	// A repeated form field is stored as a list.
+	if i := strings.LastIndexByte(n, '.'); i > 0 && isIndex(n[i+1:]) {
+		if _, ok := findKey(keys, n[:i]); ok {
+			return fmt.Sprintf("%s: multiple values not allowed", n[:i])
+		}
+	}
+	best, dist := "", 3
+	for _, k := range keys {
+		if d := editDistance(n, k.Name); d < dist {
+			best, dist = k.Name, d
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf("unknown key %s (did you mean %s?)", n, best)
+	}
+	return fmt.Sprintf("unknown key %s", n)
+}
+
+// matches returns true if the configuration key n is described by k.
+func (k Key) matches(n string) bool {
+	if strings.HasSuffix(k.Name, ".*") {
+		prefix := strings.TrimSuffix(k.Name, "*")
+		return len(n) > len(prefix) && strings.HasPrefix(n, prefix)
+	}
+	if n == k.Name {
+		return true
+	}
+	return k.List && strings.HasPrefix(n, k.Name+".") && isIndex(n[len(k.Name)+1:])
+}
+
+// isSet returns true if conf contains a non-empty value for k.
+func (k Key) isSet(conf *cfg.Config) bool {
+	if k.List {
+		for _, v := range conf.GetList(k.Name) {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	v, _ := conf.Get(k.Name)
+	return v != ""
+}
+
+// check verifies that v is a valid value for k. Empty values are valid, as they
+// select the default.
+func (k Key) check(v string) error {
+	if v == "" {
+		return nil
+	}
+	shown := fmt.Sprintf(" '%s'", v)
+	if k.Secret {
+		shown = ""
+	}
+	if k.Values != nil {
+		for _, a := range k.Values {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value%s, expected one of %s", shown, strings.Join(k.Values, ", "))
+	}
+	var err error
+	switch k.Type {
+	case TypeInt:
+		_, err = strconv.Atoi(v)
+	case TypeBool:
+		_, err = strconv.ParseBool(v)
+	case TypeFloat:
+		_, err = strconv.ParseFloat(v, 64)
+	case TypeDuration:
+		_, err = time.ParseDuration(v)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s%s", k.Type, shown)
+	}
+	return nil
+}
+
+// isIndex returns true if s is a list index.
+func isIndex(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		typ  string
+		conf map[string]string
+	}{
+		{"mysql", map[string]string{"config.user": "dns", "config.password": "secret", "config.database": "domains",
+			"config.query": "SELECT 1", "config.timeout": "5s", "config.auth": "native", "config.param.site": "office",
+			"config.refresh": "5m", "config.refresh.jitter": "0.2"}},
+		{"pattern", map[string]string{"config.pattern": "a[1-2].lan -> 10.0.0.{n}"}},
+		{"pattern", map[string]string{"config.pattern.0": "a[1-2].lan -> 10.0.0.{n}", "config.pattern.1": "b.lan -> 10.0.1.1"}},
+	} {
+		if err := Validate(tc.typ, cfg.FromMap(tc.conf)); err != nil {
+			t.Errorf("%v: %s", tc.conf, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		conf     map[string]string
+		expected []string
+	}{
+		{map[string]string{"config.user": "dns", "config.pasword": "secret", "config.database": "domains", "config.query": "SELECT 1"},
+			[]string{"unknown key config.pasword (did you mean config.password?)"}},
+		{map[string]string{"config.user": "dns", "config.database": "domains"},
+			[]string{"config.query: required key not set"}},
+		{map[string]string{"config.user": "dns", "config.database": "domains", "config.query": "SELECT 1",
+			"config.timeout": "soon", "config.auth": "kerberos", "config.refresh": "often"},
+			[]string{"config.timeout: invalid duration 'soon'", "config.auth: invalid value 'kerberos', expected one of native, cleartext, old",
+				"config.refresh: invalid duration 'often'"}},
+		{map[string]string{"config.user": "dns", "config.database": "domains", "config.query": "SELECT 1",
+			"config.host.0": "a", "config.host.1": "b", "config.foo": "bar"},
+			[]string{"config.host: multiple values not allowed", "unknown key config.foo"}},
+	} {
+		err := Validate("mysql", cfg.FromMap(tc.conf))
+		if err == nil {
+			t.Errorf("%v: expected error", tc.conf)
+			continue
+		}
+		for _, e := range tc.expected {
+			if !strings.Contains(err.Error(), e) {
+				t.Errorf("%v: expected %q in error: %s", tc.conf, e, err)
+			}
+		}
+	}
+
+	err := Validate("redis", cfg.FromMap(map[string]string{"config.prefix": "dns/", "config.db": "secret"}))
+	if err == nil || !strings.Contains(err.Error(), "config.db: invalid int 'secret'") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := Validate("missing", cfg.NewConfig()); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestSchemaSecret(t *testing.T) {
+	keys, ok := Schema("etcd")
+	if !ok {
+		t.Fatal("etcd type not registered")
+	}
+	key, ok := findKey(keys, "config.password")
+	if !ok || !key.Secret {
+		t.Fatalf("expected secret key, got %v", key)
+	}
+	if err := key.check("anything"); err != nil {
+		t.Error(err)
+	}
+	key.Type = TypeInt
+	if err := key.check("hunter2"); err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("expected error without the secret value, got %v", err)
+	}
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	RegisterExec()
+	for _, name := range Types() {
+		keys, _ := Schema(name)
+		for _, key := range append(keys, commonKeys...) {
+			if key.Default == "" {
+				continue
+			}
+			if err := key.check(key.Default); err != nil {
+				t.Errorf("%s: %s: invalid default: %s", name, key.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("sql", newSQL, Meta{
+		Description: "Name and target pairs or typed records returned by a query on any registered database/sql driver",
+		Keys: []Key{
+			{Name: "config.driver", Required: true},
+			{Name: "config.dsn", Required: true, Secret: true},
+			{Name: "config.query", Required: true},
+			{Name: "config.placeholder", Values: []string{"?", "$", "@p", ":"}},
+			{Name: "config.param.*"},
+		},
+	})
+}
+
+// sqlgen is a generator that yields the rows returned by a query on a database/sql
+// database. The query must return at least two columns: the source and the target of
+// each entry. Further columns are named after the fields of typed records: type, ttl,
+// priority, weight, port and data.
+type sqlgen struct {
+	driver string
+	db     *sql.DB
+	rows   *sql.Rows
+	fields []string
+}
+
+// newSQL returns a generator for any database/sql driver linked into the program,
+// configured by config.driver, config.dsn and config.query. Named parameters in the
+// query are passed as positional arguments in the style of config.placeholder,
+// by default the one of the driver.
+func newSQL(ctx context.Context, c *cfg.Config) (Generator, error) {
+	driver, ok := c.Get("config.driver")
+	if !ok || driver == "" {
+		return nil, errors.New("sql driver not specified")
+	}
+	if !hasDriver(driver) {
+		return nil, fmt.Errorf("sql driver %s not available, known drivers: %s", driver, strings.Join(sql.Drivers(), ", "))
+	}
+	dsn, ok := c.Get("config.dsn")
+	if !ok || dsn == "" {
+		return nil, errors.New("sql dsn not specified")
+	}
+	query, ok := c.Get("config.query")
+	if !ok || query == "" {
+		return nil, errors.New("sql query not specified")
+	}
+	placeholder := c.GetVal("config.placeholder", sqlPlaceholders[driver])
+	switch placeholder {
+	case "":
+		placeholder = "?"
+	case "?", "$", "@p", ":":
+	default:
+		return nil, fmt.Errorf("invalid sql placeholder '%s', expected ?, $, @p or :", placeholder)
+	}
+	params, err := sqlParams(c)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := bindParams(query, params, placeholder, driver == "mysql")
+	if err != nil {
+		return nil, fmt.Errorf("invalid sql query: %s", err)
+	}
+	return openSQL(ctx, driver, driver, dsn, query, args)
+}
+
+// hasDriver returns true if a database/sql driver called name is registered.
+func hasDriver(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// openSQL connects to dsn using driver and runs query with arguments args. desc describes the
+// database in error messages and must not contain passwords. The query is cancelled when ctx is done.
+func openSQL(ctx context.Context, driver, desc, dsn, query string, args []interface{}) (Generator, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %s", desc, err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %s", desc, err)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to execute query on %s: %s", desc, err)
+	}
+	fields, err := sqlFields(rows)
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, fmt.Errorf("invalid query on %s: %s", desc, err)
+	}
+	return &sqlgen{driver: driver, db: db, rows: rows, fields: fields}, nil
+}
+
+// sqlFields returns the record fields named by the columns of rows after the source and target.
+func sqlFields(rows *sql.Rows) ([]string, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) < 2 {
+		return nil, fmt.Errorf("expected at least two columns, got %d", len(cols))
+	}
+	fields := make([]string, len(cols)-2)
+	for i, col := range cols[2:] {
+		fields[i] = strings.ToLower(col)
+		switch fields[i] {
+		case "type", "ttl", "priority", "weight", "port", "data":
+		default:
+			return nil, fmt.Errorf("unknown column '%s', expected type, ttl, priority, weight, port or data", col)
+		}
+	}
+	return fields, nil
+}
+
+func (s *sqlgen) Generate(ctx context.Context) (*RawEntry, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !s.rows.Next() {
+			if err := s.rows.Err(); err != nil {
+				return nil, fmt.Errorf("%s: error reading rows: %s", s.driver, err)
+			}
+			return nil, nil
+		}
+		// The first two values are the source and target
+		vals := make([]sql.NullString, len(s.fields)+2)
+		dest := make([]interface{}, len(vals))
+		for i := range vals {
+			dest[i] = &vals[i]
+		}
+		if err := s.rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("%s: error reading rows: %s", s.driver, err)
+		}
+		entry := NewRawEntry(vals[0].String, vals[1].String)
+		vals = vals[2:]
+		if entry.Source == "" && entry.Target == "" {
+			log.Printf("[dns] %s: skipping empty entry from database", s.driver)
+			continue
+		}
+		if len(s.fields) == 0 {
+			return entry, nil
+		}
+		err := parseFields(entry, func(k string) string {
+			for i := range s.fields {
+				if s.fields[i] == k {
+					return vals[i].String
+				}
+			}
+			return ""
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", s.driver, entry.Source, err)
+		}
+		if err := entry.Check(); err != nil {
+			return nil, fmt.Errorf("%s: %s", s.driver, err)
+		}
+		return entry, nil
+	}
+}
+
+// Close stops reading rows and closes the connection to the database.
+func (s *sqlgen) Close() error {
+	s.rows.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+// fakeTable is the result of any query on the fake database with the same DSN.
+type fakeTable struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+var fakeTables = map[string]fakeTable{
+	"pairs": {
+		cols: []string{"name", "address"},
+		rows: [][]driver.Value{{"a.lan", "10.0.0.1"}, {"", ""}, {"b.lan", "10.0.0.2"}},
+	},
+	"typed": {
+		cols: []string{"name", "target", "TYPE", "ttl", "priority", "weight", "port", "data"},
+		rows: [][]driver.Value{
+			{"a.lan", "10.0.0.1", nil, nil, nil, nil, nil, nil},
+			{"a.lan", "mx.lan", "mx", int64(300), int64(10), nil, nil, nil},
+			{"_http._tcp.a.lan", "a.lan", "SRV", "1h", int64(0), int64(5), int64(80), nil},
+			{"a.lan", "", "caa", nil, nil, nil, nil, `0 issue "ca.example.net"`},
+			{"a.lan", nil, "TXT", nil, nil, nil, nil, "v=spf1 -all"},
+		},
+	},
+	"unknown": {
+		cols: []string{"name", "target", "prio"},
+	},
+	"echo": {
+		cols: []string{"name", "target"},
+	},
+	"invalid": {
+		cols: []string{"name", "target", "type"},
+		rows: [][]driver.Value{{"a.lan", "10.0.0.1", "BOGUS"}},
+	},
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	t, ok := fakeTables[dsn]
+	if !ok {
+		return nil, errors.New("no such table")
+	}
+	return &fakeConn{t}, nil
+}
+
+type fakeConn struct {
+	t fakeTable
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.t}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	t fakeTable
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+// Query returns the rows of the table, or a row made of the arguments if there are any.
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if len(args) > 0 {
+		return &fakeRows{t: fakeTable{cols: s.t.cols, rows: [][]driver.Value{args}}}, nil
+	}
+	return &fakeRows{t: s.t}, nil
+}
+
+type fakeRows struct {
+	t fakeTable
+	n int
+}
+
+func (r *fakeRows) Columns() []string { return r.t.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n >= len(r.t.rows) {
+		return io.EOF
+	}
+	copy(dest, r.t.rows[r.n])
+	r.n++
+	return nil
+}
+
+func init() {
+	sql.Register("test-fake", fakeDriver{})
+}
+
+func newFakeSQL(table string) (Generator, error) {
+	return newSQL(context.Background(), cfg.FromMap(map[string]string{
+		"config.driver": "test-fake",
+		"config.dsn":    table,
+		"config.query":  "SELECT * FROM records",
+	}))
+}
+
+func TestSQLConfig(t *testing.T) {
+	base := map[string]string{
+		"config.driver": "test-fake",
+		"config.dsn":    "pairs",
+		"config.query":  "SELECT name, address FROM hosts",
+	}
+	for k, msg := range map[string]string{
+		"config.driver":      "test-fake",
+		"config.dsn":         "dsn not specified",
+		"config.query":       "query not specified",
+		"config.placeholder": "invalid sql placeholder",
+	} {
+		m := make(map[string]string)
+		for bk, v := range base {
+			m[bk] = v
+		}
+		switch k {
+		case "config.driver":
+			m[k] = "no-such-driver"
+		case "config.placeholder":
+			m[k] = "%s"
+		default:
+			delete(m, k)
+		}
+		_, err := newSQL(context.Background(), cfg.FromMap(m))
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected error containing %q, got %v", k, msg, err)
+		}
+	}
+}
+
+func TestSQLPairs(t *testing.T) {
+	g, err := newFakeSQL("pairs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	checkEntries(t, g, []RawEntry{
+		{Source: "a.lan", Target: "10.0.0.1"},
+		{Source: "b.lan", Target: "10.0.0.2"},
+	})
+}
+
+func TestSQLTyped(t *testing.T) {
+	g, err := newFakeSQL("typed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	checkEntries(t, g, []RawEntry{
+		{Source: "a.lan", Target: "10.0.0.1"},
+		{Source: "a.lan", Target: "mx.lan", Type: "MX", TTL: 5 * time.Minute, Priority: 10},
+		{Source: "_http._tcp.a.lan", Target: "a.lan", Type: "SRV", TTL: time.Hour, Weight: 5, Port: 80},
+		{Source: "a.lan", Type: "CAA", Data: `0 issue "ca.example.net"`},
+		{Source: "a.lan", Type: "TXT", Data: "v=spf1 -all"},
+	})
+}
+
+func TestSQLErrors(t *testing.T) {
+	if _, err := newFakeSQL("unknown"); err == nil {
+		t.Error("expected error for unknown column")
+	}
+	g, err := newFakeSQL("invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if _, err := g.Generate(context.Background()); err == nil {
+		t.Error("expected error for invalid record type")
+	}
+}
+
+func TestSQLParams(t *testing.T) {
+	g, err := newSQL(context.Background(), cfg.FromMap(map[string]string{
+		"config.driver":     "test-fake",
+		"config.dsn":        "echo",
+		"config.query":      "SELECT name, zone FROM hosts WHERE name = :name AND zone = :zone",
+		"config.param.name": "www",
+		"dns.zone":          "test.lan",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	checkEntries(t, g, []RawEntry{{Source: "www", Target: "test.lan"}})
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+// sqlPlaceholders maps drivers to the style of their positional placeholders;
+// drivers not listed here use "?".
+var sqlPlaceholders = map[string]string{
+	"postgres":  "$",
+	"pgx":       "$",
+	"sqlserver": "@p",
+	"mssql":     "@p",
+	"oracle":    ":",
+	"godror":    ":",
+}
+
+// sqlParams returns the values of the named parameters of queries: zone and self, the
+// zone and name of this server, and the user defined config.param.* keys.
+func sqlParams(c *cfg.Config) (map[string]string, error) {
+	params := c.Prefixed("config.param.")
+	for _, k := range []string{"zone", "self"} {
+		if _, ok := params[k]; ok {
+			return nil, fmt.Errorf("query parameter :%s is reserved", k)
+		}
+		params[k] = c.GetVal("dns."+k, "")
+	}
+	for k := range params {
+		if !isParamName(k) {
+			return nil, fmt.Errorf("invalid query parameter name '%s'", k)
+		}
+	}
+	return params, nil
+}
+
+// bindParams replaces the named parameters like :name in query with positional placeholders
+// of the given style ("?", "$", "@p" or ":") and returns the query and the arguments to
+// execute it with. Quoted strings and identifiers, comments and "::" casts are left untouched.
+// If mysql is true, backslash escapes in strings and "#" comments are recognized.
+func bindParams(query string, params map[string]string, style string, mysql bool) (string, []interface{}, error) {
+	var b strings.Builder
+	var args []interface{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(query) && query[j] != c; j++ {
+				if mysql && query[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(query) {
+				return "", nil, fmt.Errorf("unterminated quote at offset %d", i)
+			}
+			b.WriteString(query[i : j+1])
+			i = j + 1
+		case strings.HasPrefix(query[i:], "--") || mysql && c == '#':
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				return "", nil, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			b.WriteString(query[i : i+j+4])
+			i += j + 4
+		case strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isParamStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isParamChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := params[name]
+			if !ok {
+				return "", nil, fmt.Errorf("unknown query parameter :%s", name)
+			}
+			args = append(args, v)
+			if style == "?" {
+				b.WriteString("?")
+			} else {
+				fmt.Fprintf(&b, "%s%d", style, len(args))
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), args, nil
+}
+
+// isParamName returns true if s can be used as the name of a query parameter.
+func isParamName(s string) bool {
+	if s == "" || !isParamStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isParamChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isParamStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isParamChar(c byte) bool {
+	return isParamStart(c) || '0' <= c && c <= '9'
+}
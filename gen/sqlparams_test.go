@@ -0,0 +1,66 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestBindParams(t *testing.T) {
+	params := map[string]string{"zone": "lan", "self": "ns.lan", "env": "prod"}
+	for _, tc := range []struct {
+		query, style string
+		mysql        bool
+		expected     string
+		args         []interface{}
+	}{
+		{"SELECT name, ip FROM hosts", "?", false, "SELECT name, ip FROM hosts", nil},
+		{"SELECT CONCAT(name, '.', :zone), ip FROM hosts WHERE env = :env", "?", true,
+			"SELECT CONCAT(name, '.', ?), ip FROM hosts WHERE env = ?", []interface{}{"lan", "prod"}},
+		{"SELECT name || '.' || :zone, ip::text FROM hosts WHERE env = :env AND ns = :self", "$", false,
+			"SELECT name || '.' || $1, ip::text FROM hosts WHERE env = $2 AND ns = $3", []interface{}{"lan", "prod", "ns.lan"}},
+		{"SELECT ':zone', \"a:b\" -- :env\nFROM t /* :self */ WHERE x = :env", "@p", false,
+			"SELECT ':zone', \"a:b\" -- :env\nFROM t /* :self */ WHERE x = @p1", []interface{}{"prod"}},
+		{"SELECT 'it\\'s :zone', `:env` # :self\nFROM t", "?", true,
+			"SELECT 'it\\'s :zone', `:env` # :self\nFROM t", nil},
+		{"SELECT a[1:2], @v := :zone FROM t", ":", false, "SELECT a[1:2], @v := :1 FROM t", []interface{}{"lan"}},
+	} {
+		query, args, err := bindParams(tc.query, params, tc.style, tc.mysql)
+		if err != nil {
+			t.Errorf("%s: %s", tc.query, err)
+			continue
+		}
+		if query != tc.expected || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: expected %q %v, got %q %v", tc.query, tc.expected, tc.args, query, args)
+		}
+	}
+	for _, query := range []string{"SELECT :unknown", "SELECT 'unterminated", "SELECT 1 /* comment"} {
+		if _, _, err := bindParams(query, params, "?", false); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
+
+func TestSQLParamsConfig(t *testing.T) {
+	params, err := sqlParams(cfg.FromMap(map[string]string{
+		"dns.zone":         "lan",
+		"dns.self":         "ns.lan",
+		"config.param.env": "prod",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(params, map[string]string{"zone": "lan", "self": "ns.lan", "env": "prod"}) {
+		t.Errorf("unexpected parameters %v", params)
+	}
+	for _, k := range []string{"config.param.zone", "config.param.a-b"} {
+		if _, err := sqlParams(cfg.FromMap(map[string]string{k: "x"})); err == nil {
+			t.Errorf("%s: expected error", k)
+		}
+	}
+}
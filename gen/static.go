@@ -5,37 +5,81 @@
 package gen
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/dullgiulio/kuradns/cfg"
 )
 
-// staticgen is a generator that yealds a single static entry
-type staticgen struct {
-	ch chan *RawEntry
+func init() {
+	Register("static", newStaticgen, Meta{
+		Description: "Entries given in the configuration",
+		Keys: []Key{
+			{Name: "config.key", List: true},
+			{Name: "config.val", List: true},
+			{Name: "config.entries"},
+		},
+	})
 }
 
-func newStaticgen(c *cfg.Config) (*staticgen, error) {
-	key, ok := c.Get("config.key")
-	if !ok {
+// newStaticgen returns a generator that yields static entries. Entries are given
+// as config.key and config.val, repeated for more than one entry, or as a JSON array
+// in config.entries of {"key": ..., "val": ...} objects or [key, val] pairs.
+func newStaticgen(ctx context.Context, c *cfg.Config) (Generator, error) {
+	if v, ok := c.Get("config.entries"); ok {
+		entries, err := parseStaticEntries(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entries: %s", err)
+		}
+		return newListgen(entries), nil
+	}
+	keys := c.GetList("config.key")
+	if keys == nil {
 		return nil, errors.New("key not specified")
 	}
-	val, ok := c.Get("config.val")
-	if !ok {
+	vals := c.GetList("config.val")
+	if vals == nil {
 		return nil, errors.New("val not specified")
 	}
-	s := &staticgen{
-		ch: make(chan *RawEntry),
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("%d keys but %d vals specified", len(keys), len(vals))
 	}
-	go s.run(key, val)
-	return s, nil
-}
-
-func (s *staticgen) run(key, val string) {
-	s.ch <- NewRawEntry(key, val)
-	close(s.ch)
+	entries := make([]*RawEntry, len(keys))
+	for i := range keys {
+		entries[i] = NewRawEntry(keys[i], vals[i])
+	}
+	return newListgen(entries), nil
 }
 
-func (s *staticgen) Generate() (*RawEntry, error) {
-	return <-s.ch, nil
+// parseStaticEntries decodes the JSON array of entries in s.
+func parseStaticEntries(s string) ([]*RawEntry, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal([]byte(s), &list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no entries")
+	}
+	entries := make([]*RawEntry, len(list))
+	for i, raw := range list {
+		var (
+			pair []string
+			obj  struct{ Key, Val string }
+		)
+		if err := json.Unmarshal(raw, &pair); err == nil {
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("entry %d: expected [key, val]", i+1)
+			}
+			obj.Key, obj.Val = pair[0], pair[1]
+		} else if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("entry %d: expected [key, val] or {\"key\": ..., \"val\": ...}", i+1)
+		}
+		if obj.Key == "" || obj.Val == "" {
+			return nil, fmt.Errorf("entry %d: key and val must not be empty", i+1)
+		}
+		entries[i] = NewRawEntry(obj.Key, obj.Val)
+	}
+	return entries, nil
 }
@@ -0,0 +1,54 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestStaticgen(t *testing.T) {
+	for _, conf := range []map[string]string{
+		{"config.key": "b.lan", "config.val": "10.0.0.2",
+			"config.key.0": "a.lan", "config.key.1": "b.lan",
+			"config.val.0": "10.0.0.1", "config.val.1": "10.0.0.2"},
+		{"config.entries": `[{"key": "a.lan", "val": "10.0.0.1"}, ["b.lan", "10.0.0.2"]]`},
+	} {
+		g, err := newStaticgen(context.Background(), cfg.FromMap(conf))
+		if err != nil {
+			t.Errorf("%v: %s", conf, err)
+			continue
+		}
+		for _, name := range []string{"a.lan", "b.lan", ""} {
+			e, _ := g.Generate(context.Background())
+			if name == "" {
+				if e != nil {
+					t.Errorf("%v: unexpected entry %v", conf, e)
+				}
+				break
+			}
+			if e == nil || e.Source != name {
+				t.Errorf("%v: expected entry %s, got %v", conf, name, e)
+			}
+		}
+	}
+}
+
+func TestStaticgenErrors(t *testing.T) {
+	for _, conf := range []map[string]string{
+		{"config.key": "a.lan"},
+		{"config.key.0": "a.lan", "config.key.1": "b.lan", "config.val": "10.0.0.1"},
+		{"config.entries": `[]`},
+		{"config.entries": `[["a.lan"]]`},
+		{"config.entries": `[{"key": "a.lan"}]`},
+		{"config.entries": `{"a.lan": "10.0.0.1"}`},
+	} {
+		if _, err := newStaticgen(context.Background(), cfg.FromMap(conf)); err == nil {
+			t.Errorf("expected error for %v", conf)
+		}
+	}
+}
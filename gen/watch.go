@@ -0,0 +1,197 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+// Op is the kind of change carried by a Delta.
+type Op int
+
+const (
+	// Add an entry
+	OpAdd Op = iota
+	// Remove an entry previously generated
+	OpRemove
+)
+
+// Delta is an incremental change to the entries yielded by a generator.
+// If Err is not nil, the generator failed to produce changes and Entry is nil.
+type Delta struct {
+	Op    Op
+	Entry *RawEntry
+	Err   error
+}
+
+// Watcher is a Generator that, after yielding its initial entries with Generate,
+// pushes changes to those entries as they happen until it is closed.
+type Watcher interface {
+	Generator
+	// Watch returns the channel of changes. The channel is closed after Close.
+	Watch() <-chan *Delta
+}
+
+// errUnchanged is returned by a poller load function when there is nothing new to load.
+var errUnchanged = errors.New("unchanged")
+
+// poller is a Watcher that periodically loads all entries and pushes the differences
+// with the previous load as changes.
+type poller struct {
+	*listgen
+	load     loadFunc
+	interval time.Duration
+	current  map[RawEntry]bool
+	ch       chan *Delta
+	// Context of the loads after the initial one, cancelled by Close
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started sync.Once
+}
+
+// loadFunc loads all entries of a poller. Loading should be aborted when ctx is done.
+type loadFunc func(ctx context.Context) ([]*RawEntry, error)
+
+// newPoller performs the initial load with ctx and returns a poller that calls load every interval.
+func newPoller(ctx context.Context, interval time.Duration, load loadFunc) (*poller, error) {
+	entries, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pctx, cancel := context.WithCancel(context.Background())
+	return &poller{
+		listgen:  newListgen(entries),
+		load:     load,
+		interval: interval,
+		current:  entrySet(entries),
+		ch:       make(chan *Delta),
+		ctx:      pctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// entrySet makes a set of entries.
+func entrySet(entries []*RawEntry) map[RawEntry]bool {
+	m := make(map[RawEntry]bool, len(entries))
+	for _, e := range entries {
+		m[*e] = true
+	}
+	return m
+}
+
+func (p *poller) Watch() <-chan *Delta {
+	p.started.Do(func() {
+		go p.run()
+	})
+	return p.ch
+}
+
+// Close stops polling, aborting a load in progress.
+func (p *poller) Close() error {
+	p.cancel()
+	return p.listgen.Close()
+}
+
+func (p *poller) run() {
+	defer close(p.ch)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-t.C:
+		}
+		entries, err := p.load(p.ctx)
+		if err == errUnchanged {
+			continue
+		}
+		if err != nil {
+			if !p.send(&Delta{Err: err}) {
+				return
+			}
+			continue
+		}
+		next := entrySet(entries)
+		for e := range p.current {
+			if next[e] {
+				continue
+			}
+			e := e
+			if !p.send(&Delta{Op: OpRemove, Entry: &e}) {
+				return
+			}
+		}
+		for _, e := range entries {
+			if p.current[*e] {
+				continue
+			}
+			// Duplicated entries are added only once
+			p.current[*e] = true
+			if !p.send(&Delta{Op: OpAdd, Entry: e}) {
+				return
+			}
+		}
+		p.current = next
+	}
+}
+
+// send pushes d to the consumer; it returns false if the poller was closed meanwhile.
+func (p *poller) send(d *Delta) bool {
+	select {
+	case p.ch <- d:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// fileLoader returns a function that reads entries in format from the file at path.
+// The function returns errUnchanged if the file was not modified since the last read.
+func fileLoader(path, format, kind string, c *cfg.Config) loadFunc {
+	var (
+		mtime time.Time
+		size  int64 = -1
+	)
+	return func(context.Context) ([]*RawEntry, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open %s: %s", kind, err)
+		}
+		if fi.ModTime().Equal(mtime) && fi.Size() == size {
+			return nil, errUnchanged
+		}
+		entries, err := parseFile(path, format, kind, c)
+		if err != nil {
+			return nil, err
+		}
+		mtime, size = fi.ModTime(), fi.Size()
+		return entries, nil
+	}
+}
+
+// newFilegen returns a generator yielding the entries read from the file at path.
+// If config.watch is set, the file is checked for changes at that interval.
+func newFilegen(ctx context.Context, c *cfg.Config, path, format, kind string) (Generator, error) {
+	interval, err := c.GetDuration("config.watch", 0)
+	if err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		return newPoller(ctx, interval, fileLoader(path, format, kind, c))
+	}
+	entries, err := parseFile(path, format, kind, c)
+	if err != nil {
+		return nil, err
+	}
+	return newListgen(entries), nil
+}
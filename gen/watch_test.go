@@ -0,0 +1,63 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPollerDeltas(t *testing.T) {
+	loads := [][]*RawEntry{
+		{NewRawEntry("a.lan", "10.0.0.1"), NewRawEntry("b.lan", "10.0.0.2")},
+		nil, // unchanged
+		{NewRawEntry("b.lan", "10.0.0.2"), NewRawEntry("c.lan", "10.0.0.3"), NewRawEntry("c.lan", "10.0.0.3")},
+		nil, // error
+	}
+	var n int
+	load := func(context.Context) ([]*RawEntry, error) {
+		defer func() { n++ }()
+		switch {
+		case n >= len(loads):
+			return nil, errUnchanged
+		case n == 1:
+			return nil, errUnchanged
+		case n == 3:
+			return nil, errors.New("broken")
+		}
+		return loads[n], nil
+	}
+	p, err := newPoller(context.Background(), time.Millisecond, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.lan", "b.lan"} {
+		if e, _ := p.Generate(context.Background()); e == nil || e.Source != name {
+			t.Fatalf("expected initial entry %s, got %v", name, e)
+		}
+	}
+	if e, _ := p.Generate(context.Background()); e != nil {
+		t.Fatalf("expected end of initial entries, got %v", e)
+	}
+	ch := p.Watch()
+	expected := []Delta{
+		{Op: OpRemove, Entry: NewRawEntry("a.lan", "10.0.0.1")},
+		{Op: OpAdd, Entry: NewRawEntry("c.lan", "10.0.0.3")},
+	}
+	for _, exp := range expected {
+		d := <-ch
+		if d.Err != nil || d.Op != exp.Op || *d.Entry != *exp.Entry {
+			t.Fatalf("expected %v %v, got %v %v (%v)", exp.Op, exp.Entry, d.Op, d.Entry, d.Err)
+		}
+	}
+	if d := <-ch; d.Err == nil {
+		t.Fatalf("expected error delta, got %v %v", d.Op, d.Entry)
+	}
+	p.Close()
+	for range ch {
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func init() {
+	Register("zonefile", newZonefile, Meta{
+		Description: "Records in a RFC 1035 zone file",
+		Keys: []Key{
+			{Name: "config.path", Required: true},
+			{Name: "config.origin"},
+			{Name: "config.watch", Type: TypeDuration},
+		},
+	})
+}
+
+// newZonefile returns a generator yielding the records of the RFC 1035 master file
+// at config.path. Relative names are completed with config.origin, by default the
+// zone served. SOA and NS records are skipped, as kuradns is the authority of its zone.
+func newZonefile(ctx context.Context, c *cfg.Config) (Generator, error) {
+	path, ok := c.Get("config.path")
+	if !ok || path == "" {
+		return nil, errors.New("zone file path not specified")
+	}
+	return newFilegen(ctx, c, path, "zone", "zone file")
+}
+
+// parseZone reads the supported records in zone file format from r. file is only used in errors.
+func parseZone(r io.Reader, origin, file string) ([]*RawEntry, error) {
+	var err error
+	entries := make([]*RawEntry, 0)
+	// The channel must be drained for the parser to terminate.
+	for t := range dns.ParseZone(r, dns.Fqdn(origin), file) {
+		if t.Error != nil {
+			if err == nil {
+				err = t.Error
+			}
+			continue
+		}
+		if e := rrEntry(t.RR); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// rrEntry converts rr into an entry. Nil is returned for unsupported record types.
+func rrEntry(rr dns.RR) *RawEntry {
+	hdr := rr.Header()
+	e := &RawEntry{
+		Source: strings.TrimSuffix(hdr.Name, "."),
+		TTL:    time.Duration(hdr.Ttl) * time.Second,
+	}
+	switch v := rr.(type) {
+	case *dns.A:
+		e.Type, e.Target = "A", v.A.String()
+	case *dns.AAAA:
+		e.Type, e.Target = "AAAA", v.AAAA.String()
+	case *dns.CNAME:
+		e.Type, e.Target = "CNAME", strings.TrimSuffix(v.Target, ".")
+	case *dns.TXT:
+		e.Type, e.Data = "TXT", strings.Join(v.Txt, "")
+	case *dns.MX:
+		e.Type, e.Target, e.Priority = "MX", strings.TrimSuffix(v.Mx, "."), v.Preference
+	case *dns.SRV:
+		e.Type, e.Target = "SRV", strings.TrimSuffix(v.Target, ".")
+		e.Priority, e.Weight, e.Port = v.Priority, v.Weight, v.Port
+	default:
+		t, err := ParseType(dns.TypeToString[hdr.Rrtype])
+		if err != nil {
+			return nil
+		}
+		e.Type, e.Data = t, strings.TrimPrefix(rr.String(), hdr.String())
+	}
+	return e
+}
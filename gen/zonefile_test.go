@@ -0,0 +1,52 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseZone(t *testing.T) {
+	data := `$TTL 1h
+@	IN SOA ns1 hostmaster 2016010101 3600 600 86400 300
+	IN NS ns1
+	IN MX 10 mail
+ns1	IN A 10.0.0.53
+www	300 IN AAAA fe80::1
+docs	IN CNAME www.example.com.
+mail	IN TXT "v=spf1 " "-all"
+_ldap._tcp IN SRV 0 5 389 ns1
+	IN CAA 0 issue "ca.example.net"
+`
+	entries, err := parseZone(strings.NewReader(data), "example.lan", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RawEntry{
+		{Source: "example.lan", Target: "mail.example.lan", Type: "MX", TTL: time.Hour, Priority: 10},
+		{Source: "ns1.example.lan", Target: "10.0.0.53", Type: "A", TTL: time.Hour},
+		{Source: "www.example.lan", Target: "fe80::1", Type: "AAAA", TTL: 5 * time.Minute},
+		{Source: "docs.example.lan", Target: "www.example.com", Type: "CNAME", TTL: time.Hour},
+		{Source: "mail.example.lan", Type: "TXT", TTL: time.Hour, Data: "v=spf1 -all"},
+		{Source: "_ldap._tcp.example.lan", Target: "ns1.example.lan", Type: "SRV", TTL: time.Hour, Weight: 5, Port: 389},
+		{Source: "_ldap._tcp.example.lan", Type: "CAA", TTL: time.Hour, Data: `0 issue "ca.example.net"`},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i := range expected {
+		if *entries[i] != expected[i] {
+			t.Errorf("entry %d: expected %v, got %v", i, expected[i], *entries[i])
+		}
+	}
+}
+
+func TestParseZoneError(t *testing.T) {
+	if _, err := parseZone(strings.NewReader("www IN A not-an-ip\n"), "example.lan", ""); err == nil {
+		t.Error("expected error for invalid record")
+	}
+}
@@ -1,13 +1,17 @@
-package Hosts
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hosts parses files in the format of /etc/hosts.
+package hosts
 
 import (
 	"bufio"
-	"fmt"
 	"io"
-	"os"
 )
 
-type Hosts map[string]string // use net.IP?
+// Hosts maps hostnames to their addresses, in the order they appear.
+type Hosts map[string][]string // use net.IP?
 
 func isSpace(b byte) bool {
 	return b == ' ' || b == '\t'
@@ -79,14 +83,26 @@ func parseLine(m Hosts, bs []byte) error {
 			return nil
 		}
 		key := string(bs[start:end])
-		m[key] = val
+		m.add(key, val)
 	}
 	return nil
 }
 
+// add appends address val to hostname key, unless already present.
+func (h Hosts) add(key, val string) {
+	for _, v := range h[key] {
+		if v == val {
+			return
+		}
+	}
+	h[key] = append(h[key], val)
+}
+
+// Parse reads hosts file data from r. All addresses of a hostname are kept,
+// as a name can have both an IPv4 and an IPv6 address.
 func Parse(r io.Reader) (Hosts, error) {
 	s := bufio.NewScanner(r)
-	m := Hosts(make(map[string]string))
+	m := Hosts(make(map[string][]string))
 	for s.Scan() {
 		parseLine(m, s.Bytes())
 	}
@@ -0,0 +1,40 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hosts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := `# comment line
+127.0.0.1	localhost
+10.0.0.1 one.lan   uno.lan # trailing comment
+
+  fe80::1	six.lan
+10.0.0.2 one.lan
+::1	localhost
+10.0.0.1 one.lan
+`
+	h, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string][]string{
+		"localhost": {"127.0.0.1", "::1"},
+		"one.lan":   {"10.0.0.1", "10.0.0.2"},
+		"uno.lan":   {"10.0.0.1"},
+		"six.lan":   {"fe80::1"},
+	} {
+		if !reflect.DeepEqual(h[k], v) {
+			t.Errorf("expected %v for %s, got %v", v, k, h[k])
+		}
+	}
+	if len(h) != 4 {
+		t.Errorf("expected 4 entries, got %d: %v", len(h), h)
+	}
+}
@@ -6,6 +6,7 @@ package kuradns
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -15,24 +16,45 @@ import (
 	"strings"
 
 	"github.com/dullgiulio/kuradns/cfg"
+	"github.com/dullgiulio/kuradns/gen"
 )
 
 var errUnhandledURL = errors.New("unhandled URL")
 
+// badRequestError is an error caused by an invalid request. Its message is sent to the client.
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
 func (s *server) handleHttpError(w http.ResponseWriter, r *http.Request, err error) {
-	http.Error(w, "An error occurred; please refer to the logs for more information", 500)
+	if _, ok := err.(badRequestError); ok {
+		http.Error(w, err.Error(), 400)
+	} else {
+		http.Error(w, "An error occurred; please refer to the logs for more information", 500)
+	}
 	log.Printf("[error] http: %s %s %s: %s", r.RemoteAddr, r.Method, r.URL.Path, err)
 }
 
 func (s *server) handleSourceAdd(name, gentype string, conf *cfg.Config) error {
 	src := newSource(name, conf)
+	if err := src.initRefresh(); err != nil {
+		return fmt.Errorf("invalid refresh settings: %s", err)
+	}
+	src.ctx, src.cancel = context.WithCancel(s.ctx)
 	if err := src.initGenerator(); err != nil {
+		src.cancel()
 		return fmt.Errorf("cannot start generator: %s", err)
 	}
 
 	req := makeRequest(src, reqtypeAdd)
 
 	if err := req.send(s.requests); err != nil {
+		src.closeGenerator()
+		src.cancel()
 		return fmt.Errorf("cannot process %s: %s", req.String(), err)
 	}
 	if err := <-req.resp; err != nil {
@@ -48,20 +70,31 @@ func (s *server) handleSourceDelete(name string) error {
 	if err := req.send(s.requests); err != nil {
 		return fmt.Errorf("cannot process %s: %s", req.String(), err)
 	}
+	// Abort an update in progress, so that the deletion is not delayed by it
+	if cur, ok := s.findSource(name); ok {
+		cur.cancel()
+	}
 	if err := <-req.resp; err != nil {
 		return fmt.Errorf("cannot remove source: %s", err)
 	}
 	return nil
 }
 
-func (s *server) handleSourceUpdate(name string) error {
-	src := newSource(name, nil)
+func (s *server) handleSourceUpdate(name string, conf *cfg.Config) error {
+	// Without configuration keys, the source is updated with its current configuration.
+	if len(conf.Prefixed("config.")) == 0 {
+		conf = nil
+	}
+	src := newSource(name, conf)
 	req := makeRequest(src, reqtypeUp)
 
 	if err := req.send(s.requests); err != nil {
 		return fmt.Errorf("cannot process %s: %s", req.String(), err)
 	}
 	if err := <-req.resp; err != nil {
+		if _, ok := err.(badRequestError); ok {
+			return err
+		}
 		return fmt.Errorf("cannot update source: %s", err)
 	}
 	return nil
@@ -89,17 +122,104 @@ func (s *server) handleSourceList(w http.ResponseWriter, r *http.Request) error
 	defer s.mux.RUnlock()
 
 	for _, src := range s.srcs {
-		fmt.Fprintf(wb, "%s %s\n", src.name, src.conf.GetVal("source.type", "unknown"))
+		fmt.Fprintf(wb, "%s %s", src.name, src.conf.GetVal("source.type", "unknown"))
+		if src.err != nil {
+			fmt.Fprintf(wb, " error: %s", src.err)
+		}
+		fmt.Fprintf(wb, "\n")
 	}
 
 	return wb.Flush()
 }
 
-// take last value in case of duplicates
+func (s *server) handleSourceTypes(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/plain")
+	wb := bufio.NewWriter(w)
+
+	for _, name := range gen.Types() {
+		meta, _ := gen.TypeMeta(name)
+		keys, _ := gen.Schema(name)
+		var required, optional []string
+		for _, k := range keys {
+			if k.Required {
+				required = append(required, k.Name)
+			} else {
+				optional = append(optional, k.Name)
+			}
+		}
+		fmt.Fprintf(wb, "%s: %s\n", name, meta.Description)
+		if len(required) > 0 {
+			fmt.Fprintf(wb, "\trequired: %s\n", strings.Join(required, " "))
+		}
+		if len(optional) > 0 {
+			fmt.Fprintf(wb, "\toptional: %s\n", strings.Join(optional, " "))
+		}
+	}
+
+	return wb.Flush()
+}
+
+// handleSourceSchema writes the configuration keys of the source type given in the
+// type parameter, or of all types, followed by the keys common to all types.
+func (s *server) handleSourceSchema(w http.ResponseWriter, r *http.Request) error {
+	names := gen.Types()
+	if name := r.URL.Query().Get("type"); name != "" {
+		if _, ok := gen.TypeMeta(name); !ok {
+			return badRequestError{fmt.Errorf("unknown source type '%s'", name)}
+		}
+		names = []string{name}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	wb := bufio.NewWriter(w)
+
+	for _, name := range names {
+		meta, _ := gen.TypeMeta(name)
+		keys, _ := gen.Schema(name)
+		fmt.Fprintf(wb, "%s: %s\n", name, meta.Description)
+		writeKeys(wb, keys)
+	}
+	fmt.Fprintf(wb, "all types:\n")
+	writeKeys(wb, gen.CommonKeys())
+
+	return wb.Flush()
+}
+
+// writeKeys writes one line describing each of keys to w.
+func writeKeys(w io.Writer, keys []gen.Key) {
+	for _, k := range keys {
+		t := k.Type
+		if t == "" {
+			t = gen.TypeString
+		}
+		fmt.Fprintf(w, "\t%s %s", k.Name, t)
+		if k.Required {
+			fmt.Fprintf(w, " required")
+		}
+		if k.List {
+			fmt.Fprintf(w, " list")
+		}
+		if k.Secret {
+			fmt.Fprintf(w, " secret")
+		}
+		if k.Default != "" {
+			fmt.Fprintf(w, " default=%s", k.Default)
+		}
+		if k.Values != nil {
+			fmt.Fprintf(w, " values=%s", strings.Join(k.Values, ","))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// take last value in case of duplicates; all values are also kept as a list.
 func (s *server) configFromForm(cf *cfg.Config, form url.Values) error {
 	for k, vs := range form {
 		if strings.HasPrefix(k, "config.") || strings.HasPrefix(k, "source.") {
 			cf.Put(k, vs[len(vs)-1])
+			if len(vs) > 1 {
+				cf.PutList(k, vs)
+			}
 		}
 	}
 	return nil
@@ -115,11 +235,11 @@ func (s *server) configFromJSON(cf *cfg.Config, r io.Reader) error {
 func (s *server) getFromConf(cf *cfg.Config, key string) (string, error) {
 	if v, ok := cf.Get(key); ok {
 		if v == "" {
-			return "", fmt.Errorf("required parameter %s is empty", key)
+			return "", badRequestError{fmt.Errorf("required parameter %s is empty", key)}
 		}
 		return v, nil
 	}
-	return "", fmt.Errorf("required parameter %s not found", key)
+	return "", badRequestError{fmt.Errorf("required parameter %s not found", key)}
 }
 
 func (s *server) parseBodyData(w http.ResponseWriter, r *http.Request) (*cfg.Config, error) {
@@ -154,6 +274,9 @@ func (s *server) httpHandlePOST(w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return err
 		}
+		if err = gen.Validate(stype, conf); err != nil {
+			return badRequestError{err}
+		}
 		err = s.handleSourceAdd(sname, stype, conf)
 	case "/source/delete":
 		var sname string
@@ -168,7 +291,7 @@ func (s *server) httpHandlePOST(w http.ResponseWriter, r *http.Request) error {
 		if err != nil {
 			return err
 		}
-		err = s.handleSourceUpdate(sname)
+		err = s.handleSourceUpdate(sname, conf)
 	default:
 		return errUnhandledURL
 	}
@@ -183,6 +306,10 @@ func (s *server) httpHandleGET(w http.ResponseWriter, r *http.Request) error {
 	switch r.URL.Path {
 	case "/source/list":
 		return s.handleSourceList(w, r)
+	case "/source/types":
+		return s.handleSourceTypes(w, r)
+	case "/source/schema":
+		return s.handleSourceSchema(w, r)
 	case "/dns/dump":
 		return s.handleDnsDump(w, r)
 	case "/favicon.ico":
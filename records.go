@@ -10,6 +10,7 @@ import (
 	"log"
 	"net"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,13 +20,15 @@ import (
 )
 
 // A record containse the source and destination from the generator,
-// a precomputed A and CNAME record and a pointer to the source that
-// generated this entry.
+// a precomputed A and CNAME record or a record of another type and a
+// pointer to the source that generated this entry.
 type record struct {
 	shost, dhost host
 	a            dns.RR
 	aaaa         dns.RR
 	cname        dns.RR
+	rr           dns.RR
+	entry        gen.RawEntry
 	source       *source
 }
 
@@ -51,7 +54,7 @@ func newRecord(shost, dhost host, cname bool, ip4, ip6 net.IP, ttl time.Duration
 		r.aaaa = &dns.AAAA{
 			Hdr: dns.RR_Header{
 				Name:   shost.dns(),
-				Rrtype: dns.TypeA,
+				Rrtype: dns.TypeAAAA,
 				Class:  dns.ClassINET,
 				Ttl:    uint32(ttl.Seconds()),
 			},
@@ -72,8 +75,86 @@ func newRecord(shost, dhost host, cname bool, ip4, ip6 net.IP, ttl time.Duration
 	return r
 }
 
+// newTypedRecord allocates a record holding rr, a record of a type other than A, AAAA or CNAME.
+func newTypedRecord(shost, dhost host, rr dns.RR, src *source) *record {
+	return &record{
+		shost:  shost,
+		dhost:  dhost,
+		rr:     rr,
+		source: src,
+	}
+}
+
+// typedRR makes the resource record described by e, of a type other than A, AAAA or CNAME.
+// Records of generic types are parsed from the data of e in zone file format.
+func typedRR(e *gen.RawEntry, ttl time.Duration) (dns.RR, error) {
+	hdr := dns.RR_Header{
+		Name:   host(e.Source).dns(),
+		Rrtype: dns.StringToType[e.Type],
+		Class:  dns.ClassINET,
+		Ttl:    uint32(ttl.Seconds()),
+	}
+	switch e.Type {
+	case "TXT":
+		return &dns.TXT{Hdr: hdr, Txt: splitTxt(e.Data)}, nil
+	case "MX":
+		return &dns.MX{Hdr: hdr, Preference: e.Priority, Mx: host(e.Target).dns()}, nil
+	case "SRV":
+		return &dns.SRV{
+			Hdr:      hdr,
+			Priority: e.Priority,
+			Weight:   e.Weight,
+			Port:     e.Port,
+			Target:   host(e.Target).dns(),
+		}, nil
+	}
+	if !gen.Generic(e.Type) {
+		return nil, fmt.Errorf("%s: unsupported record type %s", e.Source, e.Type)
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", hdr.Name, hdr.Ttl, e.Type, e.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid %s record data '%s': %s", e.Source, e.Type, e.Data, err)
+	}
+	if rr == nil || rr.Header().Rrtype != hdr.Rrtype {
+		return nil, fmt.Errorf("%s: invalid %s record data '%s'", e.Source, e.Type, e.Data)
+	}
+	return rr, nil
+}
+
+// splitTxt splits s in strings of the maximum length allowed in TXT records.
+func splitTxt(s string) []string {
+	const max = 255
+	txt := make([]string, 0, len(s)/max+1)
+	for len(s) > max {
+		txt = append(txt, s[:max])
+		s = s[max:]
+	}
+	return append(txt, s)
+}
+
+// rrFor returns the resource record of type qtype held by r or nil.
+func (r record) rrFor(qtype uint16) dns.RR {
+	switch qtype {
+	case dns.TypeA:
+		return r.a
+	case dns.TypeAAAA:
+		return r.aaaa
+	case dns.TypeCNAME:
+		return r.cname
+	}
+	if r.rr != nil && r.rr.Header().Rrtype == qtype {
+		return r.rr
+	}
+	return nil
+}
+
 // target returns the human DNS representation of the destination/target or a record.
+// For records of types other than A, AAAA and CNAME, the type and data are returned.
 func (r record) target() string {
+	if r.rr != nil {
+		hdr := r.rr.Header()
+		return dns.TypeToString[hdr.Rrtype] + " " + strings.TrimPrefix(r.rr.String(), hdr.String())
+	}
 	return r.dhost.browser()
 }
 
@@ -114,6 +195,22 @@ func (r *records) deleteSource(s *source) int {
 	return len(r.recs)
 }
 
+// deleteEntry removes the records added by source s for entry e.
+// Returns the number of records left.
+func (r *records) deleteEntry(s *source, e *gen.RawEntry) int {
+	res := make([]record, 0, len(r.recs))
+	for _, rec := range r.recs {
+		if rec.source.name != s.name || rec.entry != *e {
+			res = append(res, rec)
+		}
+	}
+	if len(res) == 0 {
+		res = nil
+	}
+	r.recs = res
+	return len(r.recs)
+}
+
 // pushFront adds a record to the collection.
 func (r *records) pushFront(rec *record) {
 	r.recs = append([]record{*rec}, r.recs...)
@@ -165,23 +262,36 @@ func (r repository) deleteSource(s *source) {
 	}
 }
 
-// updateSource removes and generate again all records for source src.
-func (r repository) updateSource(src *source, zone host, ttl time.Duration) {
-	res := newResolver(src, ttl, 6)
+// deleteEntry removes the records for entry e that were inserted by source s.
+func (r repository) deleteEntry(s *source, e *gen.RawEntry) {
+	key := host(e.Source).browser()
+	recs, ok := r[key]
+	if !ok {
+		return
+	}
+	if recs.deleteEntry(s, e) == 0 {
+		delete(r, key)
+	}
+}
+
+// updateSource removes and generate again all records for source src. The error
+// that stopped the generation, if any, is returned.
+func (r repository) updateSource(src *source, zone host, ttl time.Duration) error {
+	res := newResolver(src, zone, ttl, 6)
 	errch := make(chan error)
 
 	go func() {
 		defer close(errch)
 		for {
-			rentry, err := src.gen.Generate()
+			rentry, err := src.gen.Generate(src.genCtx)
 			if err != nil {
 				log.Printf("[error] generator: cannot generate repository entries: %s", err)
 				errch <- err // Single write chan, will exit after
 			}
 			if err != nil || rentry == nil {
-				close(res.rentries)
 				// Free up resources used by the generator
-				src.gen = nil
+				src.closeGenerator()
+				close(res.rentries)
 				return
 			}
 			src := host(rentry.Source)
@@ -195,6 +305,7 @@ func (r repository) updateSource(src *source, zone host, ttl time.Duration) {
 
 	recs := res.records
 
+	var genErr error
 	for {
 		select {
 		case rec := <-recs:
@@ -204,19 +315,21 @@ func (r repository) updateSource(src *source, zone host, ttl time.Duration) {
 				r.add(rec.shost, rec)
 			}
 		case err := <-errch:
-			src.err = err
+			genErr = err
 			errch = nil
 		}
 		if recs == nil && errch == nil {
 			break
 		}
 	}
+	return genErr
 }
 
 // resolver is a worker that resolves strings into IPs.
 type resolver struct {
 	cname    bool
 	src      *source
+	zone     host
 	ttl      time.Duration
 	rentries chan *gen.RawEntry
 	records  chan *record
@@ -224,10 +337,11 @@ type resolver struct {
 }
 
 // Allocate a new resolver. Subsequent records will be generated with ttl set as given here.
-// workers is number of workers to be run in parallel.
-func newResolver(src *source, ttl time.Duration, workers int) *resolver {
+// Targets inside zone are not looked up. workers is number of workers to be run in parallel.
+func newResolver(src *source, zone host, ttl time.Duration, workers int) *resolver {
 	r := &resolver{
 		src:      src,
+		zone:     zone,
 		ttl:      ttl,
 		rentries: make(chan *gen.RawEntry),
 		records:  make(chan *record),
@@ -246,30 +360,82 @@ func newResolver(src *source, ttl time.Duration, workers int) *resolver {
 // run resolves incoming entries and emits records. It is called automatically.
 func (r *resolver) run() {
 	for rentry := range r.rentries {
-		var cname bool
-		var ip4, ip6 net.IP
-		ip := net.ParseIP(rentry.Target)
-		if ip != nil {
-			if ip.To4() == nil {
-				ip6 = ip
-			} else {
-				ip4 = ip
-			}
-		} else {
-			var err error
-			// It's an hostname: resolve it and make both A and CNAME records
-			ip4, ip6, err = lookup(rentry.Target)
-			if err != nil {
-				log.Printf("[error] repository: failed lookup of %s: %s", rentry.Target, err)
-				continue
-			}
-			cname = true
+		rec, err := r.resolve(rentry)
+		if err != nil {
+			log.Printf("[error] repository: %s", err)
+			continue
 		}
-		r.records <- newRecord(host(rentry.Source), host(rentry.Target), cname, ip4, ip6, r.ttl, r.src)
+		r.records <- rec
 	}
 	r.wg.Done()
 }
 
+// resolve makes a record out of rentry. CNAME entries and hostname targets inside the
+// zone make a CNAME record only, as the target can only be resolved by the repository.
+// Other hostname targets are resolved into addresses; if the type of rentry allows it,
+// a CNAME record is also made.
+func (r *resolver) resolve(rentry *gen.RawEntry) (*record, error) {
+	ttl := r.ttl
+	if rentry.TTL > 0 {
+		ttl = rentry.TTL
+	}
+	switch rentry.Type {
+	case "", "A", "AAAA", "CNAME":
+		// Made from the addresses of the target below.
+	default:
+		rr, err := typedRR(rentry, ttl)
+		if err != nil {
+			return nil, err
+		}
+		rec := newTypedRecord(host(rentry.Source), host(rentry.Target), rr, r.src)
+		rec.entry = *rentry
+		return rec, nil
+	}
+	var cname bool
+	var ip4, ip6 net.IP
+	ip := net.ParseIP(rentry.Target)
+	if ip != nil {
+		if rentry.Type == "CNAME" {
+			return nil, fmt.Errorf("%s: CNAME target %s is not a hostname", rentry.Source, rentry.Target)
+		}
+		if ip.To4() == nil {
+			ip6 = ip
+		} else {
+			ip4 = ip
+		}
+	} else if rentry.Type == "CNAME" || rentry.Type == "" && r.inZone(host(rentry.Target)) {
+		cname = true
+	} else {
+		var err error
+		// It's an hostname: resolve it and make both A and CNAME records
+		ip4, ip6, err = lookup(rentry.Target)
+		if err != nil {
+			return nil, fmt.Errorf("failed lookup of %s: %s", rentry.Target, err)
+		}
+		cname = rentry.Type == "" || rentry.Type == "CNAME"
+	}
+	switch rentry.Type {
+	case "A":
+		if ip4 == nil {
+			return nil, fmt.Errorf("%s: no IPv4 address for A record target %s", rentry.Source, rentry.Target)
+		}
+		ip6 = nil
+	case "AAAA":
+		if ip6 == nil {
+			return nil, fmt.Errorf("%s: no IPv6 address for AAAA record target %s", rentry.Source, rentry.Target)
+		}
+		ip4 = nil
+	}
+	rec := newRecord(host(rentry.Source), host(rentry.Target), cname, ip4, ip6, ttl, r.src)
+	rec.entry = *rentry
+	return rec, nil
+}
+
+// inZone returns true if h is a name inside the zone of the resolver.
+func (r *resolver) inZone(h host) bool {
+	return r.zone != "" && h.hasSuffix(r.zone)
+}
+
 // lookup is a utility to lookup an IP for host (standard format).
 func lookup(host string) (ip4, ip6 net.IP, err error) {
 	var iplist []net.IP
@@ -291,12 +457,12 @@ func lookup(host string) (ip4, ip6 net.IP, err error) {
 	return
 }
 
-// get returns the default record for host hs or nil if not found.
+// find returns the records for host hs or nil if not found.
 // host will also be matched against all wildcards; first matching wildcard entry is returned.
-func (r repository) get(hs host) *record {
+func (r repository) find(hs host) *records {
 	rs, ok := r[hs.browser()]
 	if ok {
-		return &rs.recs[0]
+		return rs
 	}
 	for k := range r {
 		khost := host(k)
@@ -304,13 +470,65 @@ func (r repository) get(hs host) *record {
 			continue
 		}
 		if khost.match(hs) {
-			rs = r[khost.browser()]
-			return &rs.recs[0]
+			return r[khost.browser()]
+		}
+	}
+	return nil
+}
+
+// get returns the default resource record of type qtype for host hs or nil if not found.
+// The default is the most recently added record having a resource record of that type.
+func (r repository) get(hs host, qtype uint16) dns.RR {
+	rs := r.find(hs)
+	if rs == nil {
+		return nil
+	}
+	for i := range rs.recs {
+		if rr := rs.recs[i].rrFor(qtype); rr != nil {
+			return rr
 		}
 	}
 	return nil
 }
 
+// Maximum number of CNAME records followed to find the records of a host.
+const maxCNAMEChain = 8
+
+// getChain returns the default resource record of type qtype for host hs. If hs has a
+// CNAME record instead, the CNAME records leading to the record of type qtype in the
+// repository are returned before it; the CNAME records alone are returned if the
+// repository does not contain the last target.
+func (r repository) getChain(hs host, qtype uint16) []dns.RR {
+	var rrs []dns.RR
+	for i := 0; i < maxCNAMEChain; i++ {
+		if rr := r.get(hs, qtype); rr != nil {
+			return append(rrs, rr)
+		}
+		rr, ok := r.get(hs, dns.TypeCNAME).(*dns.CNAME)
+		if !ok {
+			break
+		}
+		rrs = append(rrs, rr)
+		hs = host(rr.Target)
+	}
+	return rrs
+}
+
+// getAll returns all resource records of type qtype for host hs.
+func (r repository) getAll(hs host, qtype uint16) []dns.RR {
+	rs := r.find(hs)
+	if rs == nil {
+		return nil
+	}
+	var rrs []dns.RR
+	for i := range rs.recs {
+		if rr := rs.recs[i].rrFor(qtype); rr != nil {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
 // clone duplicates the whole repository.
 func (r repository) clone() repository {
 	nr := makeRepository()
@@ -341,7 +559,7 @@ func (r repository) WriteTo(w io.Writer) (int64, error) {
 		}
 		m, err := fmt.Fprintf(w, fmtstr, frs[i].dst, frs[i].src)
 		if err != nil {
-			return n+int64(m), err
+			return n + int64(m), err
 		}
 		n += int64(m)
 	}
@@ -4,7 +4,14 @@
 
 package kuradns
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/dullgiulio/kuradns/gen"
+)
 
 func TestHostHasSuffix(t *testing.T) {
 	h1 := host("some.host")
@@ -19,3 +26,90 @@ func TestHostHasSuffix(t *testing.T) {
 		t.Errorf("%s does not have suffix %s", h1.dns(), h3.dns())
 	}
 }
+
+func TestResolveTyped(t *testing.T) {
+	r := &resolver{src: newSource("test", nil), ttl: time.Hour}
+
+	e := gen.NewRawEntry("a.lan", "10.0.0.1")
+	e.TTL = 5 * time.Minute
+	rec, err := r.resolve(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.a == nil || rec.aaaa != nil || rec.cname != nil {
+		t.Errorf("expected only an A record, got %v %v %v", rec.a, rec.aaaa, rec.cname)
+	}
+	if ttl := rec.a.Header().Ttl; ttl != 300 {
+		t.Errorf("expected TTL 300, got %d", ttl)
+	}
+
+	e = gen.NewRawEntry("b.lan", "fe80::1")
+	rec, err = r.resolve(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.aaaa == nil || rec.aaaa.Header().Rrtype != dns.TypeAAAA {
+		t.Errorf("expected AAAA record, got %v", rec.aaaa)
+	}
+	if ttl := rec.aaaa.Header().Ttl; ttl != 3600 {
+		t.Errorf("expected default TTL 3600, got %d", ttl)
+	}
+
+	for _, typ := range []string{"CNAME", "AAAA"} {
+		e = gen.NewRawEntry("c.lan", "10.0.0.2")
+		e.Type = typ
+		if _, err := r.resolve(e); err == nil {
+			t.Errorf("expected error for %s record with IPv4 target", typ)
+		}
+	}
+}
+
+func TestRepositoryGetTyped(t *testing.T) {
+	src := newSource("test", nil)
+	res := &resolver{src: src, ttl: time.Hour}
+	repo := makeRepository()
+	for _, e := range []*gen.RawEntry{
+		{Source: "mail.lan", Target: "10.0.0.25"},
+		{Source: "mail.lan", Type: "MX", Target: "mx1.lan", Priority: 10},
+		{Source: "mail.lan", Type: "MX", Target: "mx2.lan", Priority: 20},
+		{Source: "mail.lan", Type: "TXT", Data: "v=spf1 -all"},
+	} {
+		rec, err := res.resolve(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.add(host(e.Source), rec)
+	}
+	if rr := repo.get(host("mail.lan"), dns.TypeA); rr == nil {
+		t.Error("expected A record not to be shadowed by other types")
+	}
+	if rrs := repo.getAll(host("mail.lan"), dns.TypeMX); len(rrs) != 2 {
+		t.Errorf("expected two MX records, got %v", rrs)
+	}
+	rr, ok := repo.get(host("mail.lan"), dns.TypeTXT).(*dns.TXT)
+	if !ok || len(rr.Txt) != 1 || rr.Txt[0] != "v=spf1 -all" {
+		t.Errorf("unexpected TXT record %v", rr)
+	}
+	if rr := repo.get(host("mail.lan"), dns.TypeSRV); rr != nil {
+		t.Errorf("unexpected SRV record %v", rr)
+	}
+	repo.deleteEntry(src, &gen.RawEntry{Source: "mail.lan", Type: "MX", Target: "mx1.lan", Priority: 10})
+	if rrs := repo.getAll(host("mail.lan"), dns.TypeMX); len(rrs) != 1 {
+		t.Errorf("expected one MX record after deletion, got %v", rrs)
+	}
+}
+
+func TestResolveGeneric(t *testing.T) {
+	res := &resolver{src: newSource("test", nil), ttl: time.Hour}
+	rec, err := res.resolve(&gen.RawEntry{Source: "www.lan", Type: "CAA", Data: `0 issue "ca.example.net"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, ok := rec.rrFor(dns.TypeCAA).(*dns.CAA)
+	if !ok || rr.Tag != "issue" || rr.Value != "ca.example.net" || rr.Hdr.Name != "www.lan." || rr.Hdr.Ttl != 3600 {
+		t.Errorf("unexpected CAA record %v", rec.rr)
+	}
+	if _, err := res.resolve(&gen.RawEntry{Source: "www.lan", Type: "CAA", Data: "not a record"}); err == nil {
+		t.Error("expected error for invalid record data")
+	}
+}
@@ -5,6 +5,7 @@
 package kuradns
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"github.com/dullgiulio/kuradns/cfg"
+	"github.com/dullgiulio/kuradns/gen"
 )
 
 // Type of request
@@ -26,6 +28,12 @@ const (
 	reqtypeDel
 	// Update a source
 	reqtypeUp
+	// Automatic update of a source; ignored if the source was removed
+	reqtypeRefresh
+	// Apply a change pushed by the watcher of a source
+	reqtypeDelta
+	// Stop all sources and refuse further requests
+	reqtypeClose
 )
 
 var (
@@ -33,6 +41,8 @@ var (
 	errQueueFull = errors.New("queue full")
 	// Invalid request type.
 	errUnknownReqType = errors.New("unknown request type")
+	// Error returned for requests made after the server was closed.
+	errServerClosed = errors.New("server closed")
 )
 
 // response represents the value returned from a server operation.
@@ -43,6 +53,17 @@ type request struct {
 	resp  chan response
 	src   *source
 	rtype reqtype
+	delta *delta
+}
+
+// delta is a change to the records of a source pushed by its watcher.
+type delta struct {
+	// Watcher that produced the change
+	w gen.Watcher
+	// Change as pushed by the watcher
+	d *gen.Delta
+	// Record to add, already resolved
+	rec *record
 }
 
 // makeRequest allocates a request of type t and source src.
@@ -85,6 +106,12 @@ func (r request) String() string {
 		op = "rem"
 	case reqtypeUp:
 		op = "update"
+	case reqtypeRefresh:
+		op = "refresh"
+	case reqtypeDelta:
+		op = "change"
+	case reqtypeClose:
+		op = "close"
 	}
 	return fmt.Sprintf("%s '%s'", op, r.src.name)
 }
@@ -103,6 +130,11 @@ type server struct {
 	respPool sync.Pool
 	mux      sync.RWMutex
 	requests chan request
+	// Parent of the contexts of all sources, cancelled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Set once the server is closed; only accessed by run
+	closed bool
 }
 
 // NewServer allocates a server instance. fname is the file where the session is restored
@@ -120,6 +152,7 @@ func NewServer(fname, zone, self string, verbose bool, ttl time.Duration) *serve
 		repo:     makeRepository(),
 		srcs:     makeSources(),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	go s.run()
 	if fname != "" {
 		s.restoreSources()
@@ -194,7 +227,7 @@ func (s *server) persistSources() {
 	for _, v := range s.srcs {
 		jsrcs[i] = jsonSource{
 			Name: v.name,
-			Conf: v.conf.Map(),
+			Conf: v.conf.Persistent(),
 		}
 		i++
 	}
@@ -202,12 +235,29 @@ func (s *server) persistSources() {
 		log.Printf("cannot persist sources: %s", err)
 		return
 	}
-	if err != f.Sync(); err != nil {
+	if err := f.Sync(); err != nil {
 		log.Printf("cannot flush file: %s", err)
 		return
 	}
 }
 
+// Close stops all sources, aborting their updates in progress, and closes their generators.
+// The list of persisted sources is kept. Requests made after Close fail.
+func (s *server) Close() error {
+	s.cancel()
+	req := makeRequest(newSource("", nil), reqtypeClose)
+	s.requests <- req
+	return <-req.resp
+}
+
+// findSource returns the source called name, if any.
+func (s *server) findSource(name string) (*source, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	src, ok := s.srcs[name]
+	return src, ok
+}
+
 // cloneRepo safely creates and returns a full copy of the current repository.
 func (s *server) cloneRepo() repository {
 	s.mux.RLock()
@@ -222,21 +272,125 @@ func (s *server) setRepo(repo repository) {
 	s.mux.Unlock()
 }
 
+// scheduleRefresh arms the timer for the next automatic update of src,
+// replacing any update previously scheduled. Nothing is scheduled for sources
+// without a refresh interval.
+func (s *server) scheduleRefresh(src *source) {
+	src.stopRefresh()
+	if src.refresh == 0 {
+		return
+	}
+	name := src.name
+	src.timer = time.AfterFunc(src.nextRefresh(), func() {
+		s.refreshSource(name)
+	})
+}
+
+// refreshSource queues an automatic update of the source called name and waits
+// for it to be processed. Errors are logged while processing the request.
+func (s *server) refreshSource(name string) {
+	req := makeRequest(newSource(name, nil), reqtypeRefresh)
+	s.requests <- req
+	if err := <-req.resp; err == nil {
+		s.update()
+	}
+}
+
+// startWatch starts applying changes pushed by generator g of source src,
+// if g supports pushing changes.
+func (s *server) startWatch(src *source, g gen.Generator) {
+	w, ok := g.(gen.Watcher)
+	if !ok {
+		return
+	}
+	src.watcher = w
+	go s.watch(src.name, w)
+}
+
+// watch receives changes from watcher w of the source called name and queues them
+// to be applied to the repository. New entries are resolved before being queued.
+func (s *server) watch(name string, w gen.Watcher) {
+	res := &resolver{src: newSource(name, nil), zone: s.zone, ttl: s.ttl}
+	for d := range w.Watch() {
+		dl := &delta{w: w, d: d}
+		if d.Err == nil && d.Op == gen.OpAdd {
+			if !host(d.Entry.Source).hasSuffix(s.zone) {
+				log.Printf("[error] repository: domain %s is not inside zone %s, skipped", host(d.Entry.Source).dns(), s.zone.dns())
+				continue
+			}
+			rec, err := res.resolve(d.Entry)
+			if err != nil {
+				log.Printf("[error] repository: %s", err)
+				continue
+			}
+			dl.rec = rec
+		}
+		req := makeRequest(res.src, reqtypeDelta)
+		req.delta = dl
+		s.requests <- req
+		if err := <-req.resp; err == nil && d.Err == nil {
+			s.update()
+		}
+	}
+}
+
+// applyDelta modifies the repository in place with the change in dl to source src.
+func (s *server) applyDelta(src *source, dl *delta) {
+	s.setError(src, dl.d.Err)
+	if dl.d.Err != nil {
+		log.Printf("[error] sources: %s: %s", src.name, dl.d.Err)
+		return
+	}
+	shost := host(dl.d.Entry.Source)
+	s.mux.Lock()
+	switch dl.d.Op {
+	case gen.OpAdd:
+		// Records must point to the source object kept by the server
+		dl.rec.source = src
+		s.repo.add(shost, dl.rec)
+	case gen.OpRemove:
+		s.repo.deleteEntry(src, dl.d.Entry)
+	}
+	s.mux.Unlock()
+	if s.verbose {
+		log.Printf("[info] sources: %s: applied change to %s", src.name, shost.browser())
+	}
+}
+
+// setError records err as the last error of source src, as shown in the list of sources.
+func (s *server) setError(src *source, err error) {
+	s.mux.Lock()
+	src.err = err
+	s.mux.Unlock()
+}
+
 // run serves requests queued on the requests channel. run logs errors and information if
 // server is configured as verbose. run does not return.
 func (s *server) run() {
 	for req := range s.requests {
+		if s.closed {
+			req.fail(errServerClosed)
+			continue
+		}
 		switch req.rtype {
 		case reqtypeAdd:
 			if s.srcs.has(req.src.name) {
+				req.src.closeGenerator()
+				req.src.stop()
 				req.fail(fmt.Errorf("%s: source already exists", req.String()))
 				log.Printf("[error] sources: not added existing source %s", req.src.name)
 				continue
 			}
+			g := req.src.gen
 			repo := s.cloneRepo()
-			repo.updateSource(req.src, s.zone, s.ttl)
+			err := repo.updateSource(req.src, s.zone, s.ttl)
 			s.setRepo(repo)
+			s.mux.Lock()
+			req.src.err = err
 			s.srcs[req.src.name] = req.src
+			s.mux.Unlock()
+			s.scheduleRefresh(req.src)
+			s.startWatch(req.src, g)
 			if s.verbose {
 				log.Printf("[info] sources: added source %s", req.src.name)
 			}
@@ -246,33 +400,108 @@ func (s *server) run() {
 				log.Printf("[error] sources: not removed non-existing source %s", req.src.name)
 				continue
 			}
+			s.srcs[req.src.name].stop()
 			repo := s.cloneRepo()
 			repo.deleteSource(req.src)
 			s.setRepo(repo)
+			s.mux.Lock()
 			delete(s.srcs, req.src.name)
+			s.mux.Unlock()
 			if s.verbose {
 				log.Printf("[info] sources: deleted source %s", req.src.name)
 			}
-		case reqtypeUp:
+		case reqtypeUp, reqtypeRefresh:
 			if !s.srcs.has(req.src.name) {
+				if req.rtype == reqtypeRefresh {
+					req.done()
+					continue
+				}
 				req.fail(fmt.Errorf("%s: source not found", req.String()))
 				log.Printf("[error] sources: not updated non-existing source %s", req.src.name)
 				continue
 			}
 			src := s.srcs[req.src.name]
-			repo := s.cloneRepo()
-			repo.deleteSource(src)
+			// A new configuration is only kept if all entries are generated with it. The list of
+			// sources reads the configuration, so it is only replaced with the lock held.
+			undo := func() {}
+			if req.src.conf != nil {
+				s.mux.Lock()
+				reset, err := src.reconfigure(req.src.conf)
+				s.mux.Unlock()
+				if err != nil {
+					req.fail(err)
+					log.Printf("[error] sources: %s: %s", src.name, err)
+					continue
+				}
+				undo = func() {
+					s.mux.Lock()
+					reset()
+					s.mux.Unlock()
+				}
+			}
 			if err := src.initGenerator(); err != nil {
-				src.err = err
+				undo()
+				if err == gen.ErrNotModified {
+					s.setError(src, nil)
+					src.failures = 0
+					s.scheduleRefresh(src)
+					if s.verbose {
+						log.Printf("[info] sources: source %s not modified", src.name)
+					}
+					req.done()
+					continue
+				}
+				s.setError(src, err)
+				src.failures++
+				s.scheduleRefresh(src)
 				req.fail(err)
 				log.Printf("[error] sources: %s", err)
 				continue
 			}
-			repo.updateSource(src, s.zone, s.ttl)
+			g := src.gen
+			repo := s.cloneRepo()
+			repo.deleteSource(src)
+			if err := repo.updateSource(src, s.zone, s.ttl); err != nil {
+				// The records of the last successful update keep being served
+				undo()
+				if w, ok := g.(gen.Watcher); ok {
+					w.Close()
+				}
+				s.setError(src, err)
+				src.failures++
+				s.scheduleRefresh(src)
+				req.fail(err)
+				log.Printf("[error] sources: %s: keeping previous records: %s", src.name, err)
+				continue
+			}
+			src.stopWatch()
 			s.setRepo(repo)
+			s.setError(src, nil)
+			src.failures = 0
+			s.scheduleRefresh(src)
+			s.startWatch(src, g)
 			if s.verbose {
 				log.Printf("[info] sources: updated source %s", src.name)
 			}
+		case reqtypeDelta:
+			src, ok := s.srcs[req.src.name]
+			// Changes from a watcher that was replaced or stopped are stale
+			if !ok || src.watcher != req.delta.w {
+				req.done()
+				continue
+			}
+			s.applyDelta(src, req.delta)
+			req.done()
+			// Changes do not modify the configuration of sources
+			continue
+		case reqtypeClose:
+			for _, src := range s.srcs {
+				src.stop()
+			}
+			s.closed = true
+			req.done()
+			// Sources are persisted to be restored at the next start
+			continue
 		default:
 			req.fail(errUnknownReqType)
 			log.Printf("[error] unknown request type %d", req.rtype)
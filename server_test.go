@@ -0,0 +1,291 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kuradns
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/dullgiulio/kuradns/cfg"
+	"github.com/dullgiulio/kuradns/gen"
+)
+
+func TestServerStaticSource(t *testing.T) {
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+	resolves := func(name string) bool {
+		s.mux.RLock()
+		defer s.mux.RUnlock()
+		return s.repo.get(host(name), dns.TypeA) != nil
+	}
+
+	conf := cfg.NewConfig()
+	conf.Put("source.type", "static")
+	conf.Put("config.entries", `[["a.lan", "10.0.0.1"], ["b.lan", "10.0.0.2"]]`)
+	if err := s.handleSourceAdd("group", "static", conf); err != nil {
+		t.Fatal(err)
+	}
+	if !resolves("a.lan") || !resolves("b.lan") {
+		t.Fatal("expected all entries of the source to be added")
+	}
+
+	conf = cfg.NewConfig()
+	conf.Put("config.entries", `[["b.lan", "10.0.0.2"], ["c.lan", "10.0.0.3"]]`)
+	if err := s.handleSourceUpdate("group", conf); err != nil {
+		t.Fatal(err)
+	}
+	if resolves("a.lan") || !resolves("b.lan") || !resolves("c.lan") {
+		t.Error("expected entries to be replaced by the new configuration")
+	}
+
+	conf = cfg.NewConfig()
+	conf.Put("config.entries", `[["broken"]]`)
+	if err := s.handleSourceUpdate("group", conf); err == nil {
+		t.Error("expected error updating with invalid configuration")
+	}
+	if err := s.handleSourceUpdate("group", cfg.NewConfig()); err != nil {
+		t.Errorf("expected previous configuration to be kept: %s", err)
+	}
+	if !resolves("c.lan") {
+		t.Error("expected entries of the previous configuration")
+	}
+
+	if err := s.handleSourceDelete("group"); err != nil {
+		t.Fatal(err)
+	}
+	if resolves("b.lan") {
+		t.Error("expected entries to be removed with the source")
+	}
+}
+
+func TestServerZoneCNAME(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kuradns-zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lan.zone")
+	data := "web IN A 10.0.0.80\nwww IN CNAME web\nftp IN CNAME www\nout IN CNAME web.example.com.\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+	conf := cfg.NewConfig()
+	conf.Put("source.type", "zonefile")
+	conf.Put("config.path", path)
+	if err := s.handleSourceAdd("zone", "zonefile", conf); err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(dns.Msg)
+	s.handleDnsA(host("ftp.lan."), m)
+	var answer []string
+	for _, rr := range m.Answer {
+		answer = append(answer, strings.Join(strings.Fields(rr.String()), " "))
+	}
+	expected := []string{
+		"ftp.lan. 3600 IN CNAME www.lan.",
+		"www.lan. 3600 IN CNAME web.lan.",
+		"web.lan. 3600 IN A 10.0.0.80",
+	}
+	if strings.Join(answer, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected answer %q, got %q", expected, answer)
+	}
+
+	m = new(dns.Msg)
+	s.handleDnsA(host("out.lan."), m)
+	if len(m.Answer) != 1 || m.Answer[0].Header().Rrtype != dns.TypeCNAME || m.Rcode != dns.RcodeSuccess {
+		t.Errorf("expected only CNAME for target outside of the zone, got %v", m.Answer)
+	}
+
+	// A name without records of the type queried exists: the answer is empty, not NXDOMAIN
+	for name, rcode := range map[host]int{"web.lan.": dns.RcodeSuccess, "nothing.lan.": dns.RcodeNameError} {
+		m = new(dns.Msg)
+		s.handleDnsRecords(name, dns.TypeTXT, m)
+		if len(m.Answer) != 0 || m.Rcode != rcode || len(m.Ns) != 1 || m.Ns[0].Header().Rrtype != dns.TypeSOA {
+			t.Errorf("%s: expected empty answer with rcode %s and SOA, got %s %v %v",
+				name, dns.RcodeToString[rcode], dns.RcodeToString[m.Rcode], m.Answer, m.Ns)
+		}
+	}
+}
+
+func TestSourceListUpdates(t *testing.T) {
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+	conf := cfg.NewConfig()
+	conf.Put("source.type", "static")
+	conf.Put("config.entries", `[["a.lan", "10.0.0.1"]]`)
+	if err := s.handleSourceAdd("group", "static", conf); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			conf := cfg.NewConfig()
+			conf.Put("config.entries", `[["broken"]]`)
+			if i%2 == 0 {
+				conf.Put("config.entries", `[["a.lan", "10.0.0.1"]]`)
+			}
+			s.handleSourceUpdate("group", conf)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("GET", "/source/list", nil))
+			if !strings.Contains(w.Body.String(), "group static error: ") {
+				t.Errorf("expected error of last update in list:\n%s", w.Body.String())
+			}
+			return
+		default:
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/source/list", nil))
+		}
+	}
+}
+
+func TestSourceTypes(t *testing.T) {
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/source/types", nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, line := range []string{"static: ", "mysql: ", "\trequired: config.user config.database config.query"} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %q in types list:\n%s", line, body)
+		}
+	}
+}
+
+func TestSourceAddInvalid(t *testing.T) {
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+	form := url.Values{
+		"source.name": {"typo"},
+		"source.type": {"static"},
+		"config.key":  {"a.lan"},
+		"config.vall": {"10.0.0.1"},
+	}
+	r := httptest.NewRequest("POST", "/source/add", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "unknown key config.vall (did you mean config.val?)") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := s.findSource("typo"); ok {
+		t.Error("expected invalid source not to be added")
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/source/schema?type=mysql", nil))
+	body := w.Body.String()
+	for _, line := range []string{"mysql: ", "\tconfig.password string secret\n", "\tconfig.timeout duration default=10s\n",
+		"all types:\n", "\tconfig.refresh duration\n"} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %q in schema:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "static: ") {
+		t.Errorf("unexpected other types in schema:\n%s", body)
+	}
+}
+
+// blockgen is a generator whose entries never come.
+type blockgen struct{}
+
+func (blockgen) Generate(ctx context.Context) (*gen.RawEntry, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockgen) Close() error { return nil }
+
+// The test-block type is registered for all tests of this package; it only exists in
+// the test binary.
+func init() {
+	gen.Register("test-block", func(context.Context, *cfg.Config) (gen.Generator, error) {
+		return blockgen{}, nil
+	}, gen.Meta{Description: "Blocks until cancelled"})
+}
+
+func TestServerClose(t *testing.T) {
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+
+	added := make(chan error)
+	go func() {
+		conf := cfg.NewConfig()
+		conf.Put("source.type", "test-block")
+		added <- s.handleSourceAdd("slow", "test-block", conf)
+	}()
+	// Let the add request reach the server
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan error)
+	go func() {
+		closed <- s.Close()
+	}()
+	for _, ch := range []chan error{added, closed} {
+		select {
+		case err := <-ch:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("generation not aborted by Close")
+		}
+	}
+	src, ok := s.findSource("slow")
+	if !ok || src.err == nil {
+		t.Error("expected aborted source to be added with an error")
+	}
+
+	conf := cfg.NewConfig()
+	conf.Put("source.type", "static")
+	conf.Put("config.key", "a.lan")
+	conf.Put("config.val", "10.0.0.1")
+	if err := s.handleSourceAdd("late", "static", conf); err == nil {
+		t.Error("expected error adding a source after Close")
+	}
+}
+
+func TestServerUpdateFailure(t *testing.T) {
+	s := NewServer("", "lan", "localhost", false, time.Hour)
+	conf := cfg.NewConfig()
+	conf.Put("source.type", "static")
+	conf.Put("config.key", "a.lan")
+	conf.Put("config.val", "10.0.0.1")
+	if err := s.handleSourceAdd("group", "static", conf); err != nil {
+		t.Fatal(err)
+	}
+
+	conf = cfg.NewConfig()
+	conf.Put("source.type", "test-block")
+	conf.Put("source.timeout", "50ms")
+	conf.Put("config.refresh", "1h")
+	if err := s.handleSourceUpdate("group", conf); err == nil {
+		t.Fatal("expected error from aborted update")
+	}
+	s.mux.RLock()
+	rr := s.repo.get(host("a.lan"), dns.TypeA)
+	s.mux.RUnlock()
+	if rr == nil {
+		t.Error("expected records of the previous update to be kept")
+	}
+	src, _ := s.findSource("group")
+	if src.conf.GetVal("source.type", "") != "static" || src.err == nil || src.failures != 1 {
+		t.Errorf("expected previous configuration with an error, got %s, %v, %d failures",
+			src.conf.GetVal("source.type", ""), src.err, src.failures)
+	}
+}
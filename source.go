@@ -5,7 +5,12 @@
 package kuradns
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
 
 	"github.com/dullgiulio/kuradns/cfg"
 	"github.com/dullgiulio/kuradns/gen"
@@ -14,12 +19,43 @@ import (
 // sources is the collection of source objects keyed by name.
 type sources map[string]*source
 
+// Defaults for the automatic update of sources.
+const (
+	// Fraction of the refresh interval by which updates are randomly moved
+	defaultRefreshJitter = 0.1
+	// Longest interval between failed updates, as a multiple of the refresh interval
+	defaultRefreshBackoff = 16
+	// Shortest refresh interval allowed
+	minRefresh = time.Second
+	// Longest time to generate all entries of a source
+	defaultGenerateTimeout = 5 * time.Minute
+)
+
 // source is the generator of DNS entries with its configuration and name.
 type source struct {
 	name string
+	// Last error of the source; written by the server with its lock held
 	err  error
 	conf *cfg.Config
 	gen  gen.Generator
+	// Interval between automatic updates; zero disables them
+	refresh time.Duration
+	// Random variation of refresh, as fraction of the interval
+	jitter float64
+	// Maximum interval between updates after failures
+	backoff time.Duration
+	// Number of consecutive failed updates
+	failures int
+	// Timer of the next automatic update
+	timer *time.Timer
+	// Generator pushing changes after the initial update, if any
+	watcher gen.Watcher
+	// Context of the source, cancelled when the source is deleted
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Context of the current generation of entries
+	genCtx    context.Context
+	genCancel context.CancelFunc
 }
 
 // makeSources allocates a sources collection.
@@ -42,18 +78,135 @@ func newSource(name string, conf *cfg.Config) *source {
 }
 
 // initGenerator initializes the generator for a new production of key/values.
+// gen.ErrNotModified is returned if the source has not changed since the last run.
+// The generation is aborted after source.timeout or when the source is deleted.
 func (s *source) initGenerator() error {
 	stype, ok := s.conf.Get("source.type")
 	if !ok {
 		return fmt.Errorf("cannot start generator %s: key source.type not found", s.name)
 	}
-	s.gen, s.err = gen.MakeGenerator(stype, s.conf)
-	if s.err != nil {
-		return fmt.Errorf("cannot start generator: %s", s.err)
+	timeout, err := s.conf.GetDuration("source.timeout", defaultGenerateTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot start generator: %s", err)
+	}
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+	s.genCtx, s.genCancel = context.WithTimeout(s.ctx, timeout)
+	if s.gen, err = gen.MakeGenerator(s.genCtx, stype, s.conf); err != nil {
+		s.closeGenerator()
+		if err == gen.ErrNotModified {
+			return err
+		}
+		return fmt.Errorf("cannot start generator: %s", err)
+	}
+	return nil
+}
+
+// closeGenerator releases the generator after all its entries were generated. Watchers
+// keep running until stopped with stopWatch.
+func (s *source) closeGenerator() {
+	if s.gen != nil {
+		if _, ok := s.gen.(gen.Watcher); !ok {
+			s.gen.Close()
+		}
+		s.gen = nil
+	}
+	if s.genCancel != nil {
+		s.genCancel()
+		s.genCancel = nil
+	}
+}
+
+// initRefresh reads the settings for automatic updates from the configuration.
+// config.refresh is the interval between updates, config.refresh.jitter the fraction
+// of the interval by which each update is randomly moved and config.refresh.backoff
+// the longest interval to wait when updates keep failing.
+func (s *source) initRefresh() error {
+	var err error
+	if s.refresh, err = s.conf.GetDuration("config.refresh", 0); err != nil {
+		return err
+	}
+	if s.refresh < 0 {
+		return errors.New("config.refresh: interval cannot be negative")
+	}
+	if s.refresh > 0 && s.refresh < minRefresh {
+		return fmt.Errorf("config.refresh: interval cannot be shorter than %s", minRefresh)
+	}
+	s.jitter = defaultRefreshJitter
+	if v, ok := s.conf.Get("config.refresh.jitter"); ok && v != "" {
+		if s.jitter, err = strconv.ParseFloat(v, 64); err != nil || s.jitter < 0 || s.jitter >= 1 {
+			return fmt.Errorf("config.refresh.jitter: invalid fraction '%s'", v)
+		}
+	}
+	if s.backoff, err = s.conf.GetDuration("config.refresh.backoff", s.refresh*defaultRefreshBackoff); err != nil {
+		return err
+	}
+	if s.backoff < s.refresh {
+		s.backoff = s.refresh
 	}
 	return nil
 }
 
+// reconfigure replaces the configuration of s with conf. The type of the source is kept
+// if conf does not specify one. The returned function restores the previous configuration.
+func (s *source) reconfigure(conf *cfg.Config) (func(), error) {
+	if _, ok := conf.Get("source.type"); !ok {
+		conf.Put("source.type", s.conf.GetVal("source.type", ""))
+	}
+	prev := *s
+	undo := func() {
+		s.conf, s.refresh, s.jitter, s.backoff = prev.conf, prev.refresh, prev.jitter, prev.backoff
+	}
+	if err := gen.Validate(conf.GetVal("source.type", ""), conf); err != nil {
+		return nil, badRequestError{err}
+	}
+	s.conf = conf
+	if err := s.initRefresh(); err != nil {
+		undo()
+		return nil, fmt.Errorf("invalid refresh settings: %s", err)
+	}
+	return undo, nil
+}
+
+// nextRefresh returns the time to wait before the next automatic update.
+// The interval doubles with each consecutive failure, up to the backoff limit.
+func (s *source) nextRefresh() time.Duration {
+	d := s.refresh
+	for i := 0; i < s.failures && d < s.backoff; i++ {
+		d *= 2
+	}
+	if d > s.backoff {
+		d = s.backoff
+	}
+	return d + time.Duration((rand.Float64()*2-1)*s.jitter*float64(d))
+}
+
+// stopRefresh cancels the next automatic update, if any.
+func (s *source) stopRefresh() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// stopWatch stops receiving changes from the watcher of the source, if any.
+func (s *source) stopWatch() {
+	if s.watcher != nil {
+		s.watcher.Close()
+		s.watcher = nil
+	}
+}
+
+// stop aborts the work in progress for the source and stops its automatic updates and watcher.
+func (s *source) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.stopRefresh()
+	s.stopWatch()
+}
+
 // String representation of a source is its name.
 func (s *source) String() string {
 	return s.name
@@ -0,0 +1,55 @@
+// Copyright 2016 Giulio Iotti. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kuradns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dullgiulio/kuradns/cfg"
+)
+
+func TestSourceNextRefresh(t *testing.T) {
+	src := newSource("test", cfg.FromMap(map[string]string{
+		"config.refresh":         "1m",
+		"config.refresh.jitter":  "0.1",
+		"config.refresh.backoff": "5m",
+	}))
+	if err := src.initRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []struct {
+		failures int
+		base     time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{3, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	} {
+		src.failures = p.failures
+		min, max := p.base-p.base/10, p.base+p.base/10
+		for i := 0; i < 20; i++ {
+			if d := src.nextRefresh(); d < min || d > max {
+				t.Errorf("%d failures: interval %s not in [%s, %s]", p.failures, d, min, max)
+			}
+		}
+	}
+}
+
+func TestSourceInitRefreshErrors(t *testing.T) {
+	for _, m := range []map[string]string{
+		{"config.refresh": "often"},
+		{"config.refresh": "-1m"},
+		{"config.refresh": "10ms"},
+		{"config.refresh": "1m", "config.refresh.jitter": "1.5"},
+		{"config.refresh": "1m", "config.refresh.backoff": "never"},
+	} {
+		if err := newSource("test", cfg.FromMap(m)).initRefresh(); err == nil {
+			t.Errorf("expected error for %v", m)
+		}
+	}
+}